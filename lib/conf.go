@@ -10,6 +10,8 @@ import (
 	"github.com/xiaka53/DeployAndLog/log"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 )
@@ -32,17 +34,123 @@ type LogConfFileWriter struct {
 	RotateLogPath   string `mapstructure:"rotate_log_path"`
 	WfLogPath       string `mapstructure:"wf_log_path"`
 	RotateWfLogPath string `mapstructure:"rotate_wf_log_path"`
+	Format          string `mapstructure:"format"`
+	MaxSizeMB       int    `mapstructure:"max_size_mb"`
+	MaxBackups      int    `mapstructure:"max_backups"`
+	MaxAgeDays      int    `mapstructure:"max_age_days"`
+	MaxTotalMB      int    `mapstructure:"max_total_mb"`
+	Compress        string `mapstructure:"compress"`
 }
 
 type LogConfConsoleWriter struct {
-	On    bool `mapstructure:"on"`
-	Color bool `mapstructure:"color"`
+	On     bool   `mapstructure:"on"`
+	Color  bool   `mapstructure:"color"`
+	Format string `mapstructure:"format"`
+}
+
+type LogConfSyslogWriter struct {
+	On       bool   `mapstructure:"on"`
+	Network  string `mapstructure:"network"`
+	Addr     string `mapstructure:"addr"`
+	Facility string `mapstructure:"facility"`
+	AppName  string `mapstructure:"app_name"`
+	Format   string `mapstructure:"format"`
+}
+
+type LogConfNetWriter struct {
+	On         bool   `mapstructure:"on"`
+	Network    string `mapstructure:"network"`
+	Addr       string `mapstructure:"addr"`
+	Format     string `mapstructure:"format"`
+	BufferKB   int    `mapstructure:"buffer_kb"`
+	SpillPath  string `mapstructure:"spill_path"`
+	MaxSpillMB int    `mapstructure:"max_spill_mb"`
+}
+
+type LogConfHTTPWriter struct {
+	On              bool              `mapstructure:"on"`
+	Mode            string            `mapstructure:"mode"`
+	Url             string            `mapstructure:"url"`
+	Index           string            `mapstructure:"index"`
+	Env             string            `mapstructure:"env"`
+	Labels          map[string]string `mapstructure:"labels"`
+	OTLPEncoding    string            `mapstructure:"otlp_encoding"`
+	ServiceName     string            `mapstructure:"service_name"`
+	Resource        map[string]string `mapstructure:"resource"`
+	Format          string            `mapstructure:"format"`
+	BatchSize       int               `mapstructure:"batch_size"`
+	FlushIntervalMs int               `mapstructure:"flush_interval_ms"`
+	MaxRetries      int               `mapstructure:"max_retries"`
+	MaxInFlight     int               `mapstructure:"max_in_flight"`
+	TimeoutMs       int               `mapstructure:"timeout_ms"`
+	Gzip            bool              `mapstructure:"gzip"`
+}
+
+type LogConfWebhookWriter struct {
+	On            bool   `mapstructure:"on"`
+	Kind          string `mapstructure:"kind"`
+	Url           string `mapstructure:"url"`
+	Secret        string `mapstructure:"secret"`
+	Template      string `mapstructure:"template"`
+	LevelFloor    string `mapstructure:"level_floor"`
+	LevelCeil     string `mapstructure:"level_ceil"`
+	RatePerMinute int    `mapstructure:"rate_per_minute"`
+	WindowSec     int    `mapstructure:"window_sec"`
+}
+
+type LogConfRedisWriter struct {
+	On        bool   `mapstructure:"on"`
+	Pool      string `mapstructure:"pool"`
+	Mode      string `mapstructure:"mode"`
+	Key       string `mapstructure:"key"`
+	MaxLen    int    `mapstructure:"max_len"`
+	BatchSize int    `mapstructure:"batch_size"`
+}
+
+type LogConfDBWriter struct {
+	On        bool   `mapstructure:"on"`
+	Pool      string `mapstructure:"pool"`
+	Dialect   string `mapstructure:"dialect"`
+	Table     string `mapstructure:"table"`
+	BatchSize int    `mapstructure:"batch_size"`
+}
+
+type LogConfRingWriter struct {
+	On         bool `mapstructure:"on"`
+	MaxRecords int  `mapstructure:"max_records"`
+	MaxMB      int  `mapstructure:"max_mb"`
+}
+
+type LogConfRedactRule struct {
+	Keys    []string `mapstructure:"keys"`
+	Pattern string   `mapstructure:"pattern"`
+	DLTags  []string `mapstructure:"dltags"`
+	Style   string   `mapstructure:"style"`
+	HashKey string   `mapstructure:"hash_key"`
 }
 
 type LogConfig struct {
-	Level string               `mapstructure:"log_level"`
-	FW    LogConfFileWriter    `mapstructure:"file_writer"`
-	CW    LogConfConsoleWriter `mapstructure:"console_writer"`
+	Level           string               `mapstructure:"log_level"`
+	Layout          string               `mapstructure:"layout"`
+	CallerFunc      bool                 `mapstructure:"caller_func"`
+	FieldOrder      []string             `mapstructure:"field_order"`
+	SortFields      bool                 `mapstructure:"sort_fields"`
+	Redact          []LogConfRedactRule  `mapstructure:"redact"`
+	LevelSignal     bool                 `mapstructure:"level_signal"`
+	WriterQueueSize int                  `mapstructure:"writer_queue_size"`
+	TunnelSize      int                  `mapstructure:"tunnel_size"`
+	OverflowPolicy  string               `mapstructure:"overflow_policy"`
+	BlockTimeoutMs  int                  `mapstructure:"block_timeout_ms"`
+	FW              LogConfFileWriter    `mapstructure:"file_writer"`
+	CW              LogConfConsoleWriter `mapstructure:"console_writer"`
+	SW              LogConfSyslogWriter  `mapstructure:"syslog_writer"`
+	NW              LogConfNetWriter     `mapstructure:"net_writer"`
+	HW              []LogConfHTTPWriter  `mapstructure:"http_writer"`
+	WW              LogConfWebhookWriter `mapstructure:"webhook_writer"`
+	RW              LogConfRedisWriter   `mapstructure:"redis_writer"`
+	DW              LogConfDBWriter      `mapstructure:"db_writer"`
+	RingW           LogConfRingWriter    `mapstructure:"ring_writer"`
+	Loggers         map[string]LogConfig `mapstructure:"-"`
 }
 
 type MysqlMapConf struct {
@@ -85,9 +193,6 @@ var (
 
 // 初始化base配置
 func InitBaseConf(path string) (err error) {
-	var (
-		logConf log.LogConfig
-	)
 	ConfBase = &BaseConf{}
 	if err = ParseConfig(path, ConfBase); err != nil {
 		return
@@ -106,32 +211,182 @@ func InitBaseConf(path string) (err error) {
 		} else {
 			ConfBase.TimeLocation = "Asia/Shanghai"
 		}
-		log.SetLoadLocation(ConfBase.TimeLocation)
-	}
-	if ConfBase.Log.Level == "" {
-		ConfBase.Log.Level = "trace"
 	}
+	log.SetLoadLocation(ConfBase.TimeLocation)
 
 	//配置日志
-	logConf = log.LogConfig{
-		Level: ConfBase.Log.Level,
+	if err = log.SetupDefaultLogWithConf(newLogConfig(ConfBase.Log)); err != nil {
+		panic(err)
+	}
+
+	//SIGUSR1/SIGUSR2调整日志级别
+	if ConfBase.Log.LevelSignal {
+		log.WatchLevelSignal()
+	}
+
+	//配置[log.<name>]命名日志
+	if ConfBase.Log.Loggers, err = parseNamedLogConf(path); err != nil {
+		return
+	}
+	for name, conf := range ConfBase.Log.Loggers {
+		logger := log.Get(name)
+		logger.SetLoadLocation(ConfBase.TimeLocation)
+		if err = log.SetupLogInstanceWithConf(newLogConfig(conf), logger); err != nil {
+			panic(err)
+		}
+	}
+	return
+}
+
+//转换为log包的配置
+func newLogConfig(conf LogConfig) log.LogConfig {
+	if conf.Level == "" {
+		conf.Level = "trace"
+	}
+	if conf.Layout == "" {
+		conf.Layout = "2006-01-02T15:04:05.000"
+	}
+	hw := make([]log.ConfHTTPWriter, 0, len(conf.HW))
+	for _, c := range conf.HW {
+		if c.Env == "" {
+			c.Env = ConfEnv
+		}
+		hw = append(hw, log.ConfHTTPWriter{
+			On:              c.On,
+			Mode:            c.Mode,
+			Url:             c.Url,
+			Index:           c.Index,
+			Env:             c.Env,
+			Labels:          c.Labels,
+			OTLPEncoding:    c.OTLPEncoding,
+			Resource:        newLogResource(c),
+			Format:          c.Format,
+			BatchSize:       c.BatchSize,
+			FlushIntervalMs: c.FlushIntervalMs,
+			MaxRetries:      c.MaxRetries,
+			MaxInFlight:     c.MaxInFlight,
+			TimeoutMs:       c.TimeoutMs,
+			Gzip:            c.Gzip,
+		})
+	}
+	redact := make([]log.ConfRedactRule, 0, len(conf.Redact))
+	for _, r := range conf.Redact {
+		redact = append(redact, log.ConfRedactRule{Keys: r.Keys, Pattern: r.Pattern, DLTags: r.DLTags, Style: r.Style, HashKey: r.HashKey})
+	}
+	return log.LogConfig{
+		Level:           conf.Level,
+		Layout:          conf.Layout,
+		CallerFunc:      conf.CallerFunc,
+		FieldOrder:      conf.FieldOrder,
+		SortFields:      conf.SortFields,
+		Redact:          redact,
+		WriterQueueSize: conf.WriterQueueSize,
+		TunnelSize:      conf.TunnelSize,
+		OverflowPolicy:  conf.OverflowPolicy,
+		BlockTimeoutMs:  conf.BlockTimeoutMs,
 		FW: log.ConfFileWriter{
-			On:              ConfBase.Log.FW.On,
-			LogPath:         ConfBase.Log.FW.LogPath,
-			RotateLogPath:   ConfBase.Log.FW.RotateLogPath,
-			WfLogPath:       ConfBase.Log.FW.WfLogPath,
-			RotateWfLogPath: ConfBase.Log.FW.RotateWfLogPath,
+			On:              conf.FW.On,
+			LogPath:         conf.FW.LogPath,
+			RotateLogPath:   conf.FW.RotateLogPath,
+			WfLogPath:       conf.FW.WfLogPath,
+			RotateWfLogPath: conf.FW.RotateWfLogPath,
+			Format:          conf.FW.Format,
+			MaxSizeMB:       conf.FW.MaxSizeMB,
+			MaxBackups:      conf.FW.MaxBackups,
+			MaxAgeDays:      conf.FW.MaxAgeDays,
+			MaxTotalMB:      conf.FW.MaxTotalMB,
+			Compress:        conf.FW.Compress,
 		},
 		CW: log.ConfConsoleWriter{
-			On:    ConfBase.Log.CW.On,
-			Color: ConfBase.Log.CW.Color,
+			On:     conf.CW.On,
+			Color:  conf.CW.Color,
+			Format: conf.CW.Format,
+		},
+		SW: log.ConfSyslogWriter{
+			On:       conf.SW.On,
+			Network:  conf.SW.Network,
+			Addr:     conf.SW.Addr,
+			Facility: conf.SW.Facility,
+			AppName:  conf.SW.AppName,
+			Format:   conf.SW.Format,
+		},
+		NW: log.ConfNetWriter{
+			On:         conf.NW.On,
+			Network:    conf.NW.Network,
+			Addr:       conf.NW.Addr,
+			Format:     conf.NW.Format,
+			BufferKB:   conf.NW.BufferKB,
+			SpillPath:  conf.NW.SpillPath,
+			MaxSpillMB: conf.NW.MaxSpillMB,
+		},
+		HW: hw,
+		WW: log.ConfWebhookWriter{
+			On:            conf.WW.On,
+			Kind:          conf.WW.Kind,
+			Url:           conf.WW.Url,
+			Secret:        conf.WW.Secret,
+			Template:      conf.WW.Template,
+			LevelFloor:    conf.WW.LevelFloor,
+			LevelCeil:     conf.WW.LevelCeil,
+			RatePerMinute: conf.WW.RatePerMinute,
+			WindowSec:     conf.WW.WindowSec,
+		},
+		RingW: log.ConfRingWriter{
+			On:         conf.RingW.On,
+			MaxRecords: conf.RingW.MaxRecords,
+			MaxMB:      conf.RingW.MaxMB,
 		},
 	}
+}
 
-	if err = log.SetupDefaultLogWithConf(logConf); err != nil {
-		panic(err)
+//OTLP的resource属性，默认带上服务名、环境和本机ip
+func newLogResource(conf LogConfHTTPWriter) map[string]string {
+	resource := map[string]string{
+		"service.name":           conf.ServiceName,
+		"deployment.environment": conf.Env,
+		"host.ip":                LocalIp.String(),
+	}
+	if conf.ServiceName == "" {
+		resource["service.name"] = filepath.Base(os.Args[0])
+	}
+	for k, v := range conf.Resource {
+		resource[k] = v
+	}
+	return resource
+}
+
+//解析[log.<name>]，LogConfig自身的配置项不作为日志名称
+func parseNamedLogConf(path string) (loggers map[string]LogConfig, err error) {
+	var (
+		data []byte
+		v    *viper.Viper
+	)
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	v = viper.New()
+	v.SetConfigType("toml")
+	if err = v.ReadConfig(bytes.NewBuffer(data)); err != nil {
+		return
+	}
+
+	reserved := map[string]bool{}
+	t := reflect.TypeOf(LogConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		reserved[t.Field(i).Tag.Get("mapstructure")] = true
+	}
+
+	loggers = map[string]LogConfig{}
+	for name, val := range v.GetStringMap("log") {
+		if _, ok := val.(map[string]interface{}); !ok || reserved[name] {
+			continue
+		}
+		conf := LogConfig{}
+		if err = v.UnmarshalKey("log."+name, &conf); err != nil {
+			return
+		}
+		loggers[name] = conf
 	}
-	log.SetLayout("2006-01-02T15:04:05.000")
 	return
 }
 
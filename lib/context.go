@@ -0,0 +1,19 @@
+package lib
+
+import "context"
+
+type traceContextKey struct{}
+
+// 将TraceContext放入context，供slog等基于context的日志使用
+func SetTraceContext(ctx context.Context, trace *TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+// 从context中取出TraceContext，不存在时返回nil
+func GetTraceContext(ctx context.Context) *TraceContext {
+	if ctx == nil {
+		return nil
+	}
+	trace, _ := ctx.Value(traceContextKey{}).(*TraceContext)
+	return trace
+}
@@ -0,0 +1,292 @@
+package lib
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xiaka53/DeployAndLog/log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	DBLogDialectMysql  = "mysql"
+	DBLogDialectSqlite = "sqlite3"
+)
+
+const (
+	db_log_batch_size_default = 100
+	db_log_max_pending_batch  = 100
+	db_log_backoff_min        = time.Second
+	db_log_backoff_max        = 30 * time.Second
+)
+
+var dbLogTableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var dbLogColumns = []string{"log_time", "level", "dltag", "traceid", "spanid", "caller", "message", "fields"}
+
+type dbLogRow struct {
+	logTime time.Time
+	level   string
+	dlTag   string
+	traceId string
+	spanId  string
+	caller  string
+	message string
+	fields  string
+}
+
+// 批量写入数据表，表不存在时自动创建
+// 直接使用database/sql执行，不经过gorm和DBPoolLogQuery，避免日志写入再产生日志
+type DBLogWriter struct {
+	db        *sql.DB
+	dialect   string
+	table     string
+	batchSize int
+	pending   []dbLogRow
+	// 上次写入失败，本次失败后逐条写入
+	retried bool
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// dialect为空时根据驱动类型判断
+func NewDBLogWriter(db *sql.DB, dialect, table string) *DBLogWriter {
+	return &DBLogWriter{
+		db:        db,
+		dialect:   dialect,
+		table:     table,
+		batchSize: db_log_batch_size_default,
+	}
+}
+
+func (w *DBLogWriter) SetBatchSize(n int) {
+	if n > 0 {
+		w.batchSize = n
+	}
+}
+
+func (w *DBLogWriter) Init() error {
+	if w.db == nil {
+		return errors.New("db log writer has no db")
+	}
+	if !dbLogTableRegexp.MatchString(w.table) {
+		return errors.New("Invalid db log table (" + w.table + ")")
+	}
+	if w.dialect == "" {
+		if strings.Contains(strings.ToLower(fmt.Sprintf("%T", w.db.Driver())), "sqlite") {
+			w.dialect = DBLogDialectSqlite
+		} else {
+			w.dialect = DBLogDialectMysql
+		}
+	}
+	for _, ddl := range w.schema() {
+		if _, err := w.db.Exec(ddl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *DBLogWriter) schema() []string {
+	if w.dialect == DBLogDialectSqlite {
+		return []string{
+			"CREATE TABLE IF NOT EXISTS `" + w.table + "` (" +
+				"`id` INTEGER PRIMARY KEY AUTOINCREMENT," +
+				"`log_time` DATETIME NOT NULL," +
+				"`level` VARCHAR(8) NOT NULL," +
+				"`dltag` VARCHAR(128) NOT NULL DEFAULT ''," +
+				"`traceid` VARCHAR(64) NOT NULL DEFAULT ''," +
+				"`spanid` VARCHAR(32) NOT NULL DEFAULT ''," +
+				"`caller` VARCHAR(255) NOT NULL DEFAULT ''," +
+				"`message` TEXT," +
+				"`fields` TEXT)",
+			"CREATE INDEX IF NOT EXISTS `idx_" + w.table + "_log_time` ON `" + w.table + "` (`log_time`)",
+			"CREATE INDEX IF NOT EXISTS `idx_" + w.table + "_traceid` ON `" + w.table + "` (`traceid`)",
+		}
+	}
+	return []string{
+		"CREATE TABLE IF NOT EXISTS `" + w.table + "` (" +
+			"`id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT," +
+			"`log_time` DATETIME(6) NOT NULL," +
+			"`level` VARCHAR(8) NOT NULL," +
+			"`dltag` VARCHAR(128) NOT NULL DEFAULT ''," +
+			"`traceid` VARCHAR(64) NOT NULL DEFAULT ''," +
+			"`spanid` VARCHAR(32) NOT NULL DEFAULT ''," +
+			"`caller` VARCHAR(255) NOT NULL DEFAULT ''," +
+			"`message` TEXT," +
+			"`fields` JSON," +
+			"PRIMARY KEY (`id`)," +
+			"KEY `idx_log_time` (`log_time`)," +
+			"KEY `idx_traceid` (`traceid`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+	}
+}
+
+func (w *DBLogWriter) Write(r *log.Record) error {
+	row := dbLogRow{
+		logTime: r.Timestamp(),
+		level:   log.LEVEL_FLAGS[r.Level()],
+		caller:  r.Code(),
+		message: r.Info(),
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for _, f := range r.Fields() {
+		switch f.Key {
+		case log.FieldDLTag:
+			row.dlTag = f.Text()
+			continue
+		case log.FieldTraceId:
+			row.traceId = f.Text()
+			continue
+		case log.FieldSpanId:
+			row.spanId = f.Text()
+			continue
+		}
+		key, _ := json.Marshal(f.Key)
+		value, err := json.Marshal(f.JSONValue())
+		if err != nil {
+			value, _ = json.Marshal(f.Text())
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	row.fields = buf.String()
+
+	w.pending = append(w.pending, row)
+	// 写入失败后由flush定时器按退避间隔重试，不在每次Write时重试
+	if w.retried {
+		w.trimPending()
+		return nil
+	}
+	if len(w.pending) >= w.batchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// 写入失败的记录保留到下次重试，按指数退避间隔重试，超过上限后丢弃最早的
+// 重试仍失败且数据库可用时逐条写入，丢弃仍然失败的记录并返回错误，避免一条坏数据阻塞之后的日志
+func (w *DBLogWriter) Flush() (err error) {
+	if w.retried && time.Now().Before(w.retryAt) {
+		return nil
+	}
+	for len(w.pending) > 0 {
+		n := len(w.pending)
+		if n > w.batchSize {
+			n = w.batchSize
+		}
+		if e := w.insert(w.pending[:n]); e != nil {
+			if !w.retried || w.db.Ping() != nil {
+				w.retried = true
+				w.delayRetry()
+				w.trimPending()
+				return e
+			}
+			if e = w.insertEach(w.pending[:n]); e != nil {
+				err = e
+			}
+		}
+		w.retried = false
+		w.backoff = 0
+		w.pending = w.pending[n:]
+	}
+	w.pending = nil
+	return
+}
+
+// 关闭时不等待退避，再尝试写入一次
+func (w *DBLogWriter) Close() error {
+	w.retryAt = time.Time{}
+	return w.Flush()
+}
+
+func (w *DBLogWriter) delayRetry() {
+	if w.backoff == 0 {
+		w.backoff = db_log_backoff_min
+	} else if w.backoff *= 2; w.backoff > db_log_backoff_max {
+		w.backoff = db_log_backoff_max
+	}
+	w.retryAt = time.Now().Add(w.backoff)
+}
+
+func (w *DBLogWriter) trimPending() {
+	if max := w.batchSize * db_log_max_pending_batch; len(w.pending) > max {
+		w.pending = w.pending[len(w.pending)-max:]
+	}
+}
+
+// 逐条写入，返回丢弃的条数和第一条失败的原因
+func (w *DBLogWriter) insertEach(rows []dbLogRow) error {
+	var (
+		firstErr error
+		dropped  int
+	)
+	for i := range rows {
+		if err := w.insert(rows[i : i+1]); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		return nil
+	}
+	return fmt.Errorf("db log writer dropped %d rows: %v", dropped, firstErr)
+}
+
+func (w *DBLogWriter) insert(rows []dbLogRow) error {
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?,", len(dbLogColumns)), ",") + ")"
+	values := make([]string, 0, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(dbLogColumns))
+	for _, row := range rows {
+		values = append(values, placeholder)
+		args = append(args, row.logTime, row.level, row.dlTag, row.traceId, row.spanId, row.caller, row.message, row.fields)
+	}
+	query := "INSERT INTO `" + w.table + "` (`" + strings.Join(dbLogColumns, "`,`") + "`) VALUES " + strings.Join(values, ",")
+	_, err := w.db.Exec(query, args...)
+	return err
+}
+
+//按[log.db_writer]注册，需要在数据库连接池初始化之后
+func registerDBLogWriters() error {
+	if ConfBase == nil {
+		return nil
+	}
+	if err := registerDBLogWriter(log.Default(), ConfBase.Log.DW); err != nil {
+		return err
+	}
+	for name, conf := range ConfBase.Log.Loggers {
+		if err := registerDBLogWriter(log.Get(name), conf.DW); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerDBLogWriter(logger *log.Logger, conf LogConfDBWriter) error {
+	if !conf.On {
+		return nil
+	}
+	if conf.Pool == "" {
+		conf.Pool = "default"
+	}
+	db, err := GetDBPool(conf.Pool)
+	if err != nil {
+		return errors.New("db log pool not found: " + conf.Pool)
+	}
+	w := NewDBLogWriter(db, conf.Dialect, conf.Table)
+	w.SetBatchSize(conf.BatchSize)
+	logger.Register(w)
+	return nil
+}
@@ -0,0 +1,182 @@
+package lib
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "log.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func countLogRows(t *testing.T, db *sql.DB, table string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM `" + table + "`").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func testLogRows(n int, badAt int) []dbLogRow {
+	rows := make([]dbLogRow, 0, n)
+	for i := 0; i < n; i++ {
+		row := dbLogRow{logTime: time.Now(), level: "INFO", dlTag: "_com_test", message: fmt.Sprintf("row-%03d", i), fields: "{}"}
+		if i == badAt {
+			row.dlTag = "bad"
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestDBLogWriterRecordColumns(t *testing.T) {
+	db := openTestDB(t)
+	l, rec := logtest.NewLogger()
+	w := NewDBLogWriter(db, "", "app_log")
+	l.Register(w)
+	if w.dialect != DBLogDialectSqlite {
+		t.Fatalf("dialect = %q, want %q", w.dialect, DBLogDialectSqlite)
+	}
+	l.Log(log.ERROR, "query failed", log.String(log.FieldDLTag, "_com_mysql_failure"),
+		log.String(log.FieldTraceId, "t1"), log.String(log.FieldSpanId, "s1"), log.Int("rows", 3), log.String("sql", "select 1"))
+	l.Close()
+
+	e := rec.Expect(t, logtest.DLTag("_com_mysql_failure"))
+	var level, dlTag, traceId, spanId, caller, message, fields string
+	err := db.QueryRow("SELECT `level`,`dltag`,`traceid`,`spanid`,`caller`,`message`,`fields` FROM `app_log`").
+		Scan(&level, &dlTag, &traceId, &spanId, &caller, &message, &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != "ERROR" || dlTag != e.DLTag() || traceId != e.TraceId() || spanId != "s1" || caller != e.Code || message != e.Message {
+		t.Errorf("row = %s %s %s %s %s %s, want %s", level, dlTag, traceId, spanId, caller, message, e)
+	}
+	// dltag、traceid、spanid单独成列，不再出现在fields中
+	var extra map[string]interface{}
+	if err = json.Unmarshal([]byte(fields), &extra); err != nil {
+		t.Fatalf("fields %q: %v", fields, err)
+	}
+	if len(extra) != 2 || extra["rows"] != float64(3) || extra["sql"] != "select 1" {
+		t.Errorf("fields = %s", fields)
+	}
+}
+
+func TestDBLogWriterBatchInsert(t *testing.T) {
+	db := openTestDB(t)
+	w := NewDBLogWriter(db, DBLogDialectSqlite, "app_log")
+	w.SetBatchSize(100)
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	w.pending = testLogRows(250, -1)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countLogRows(t, db, "app_log"); n != 250 {
+		t.Fatalf("inserted %d rows, want 250", n)
+	}
+	if len(w.pending) != 0 {
+		t.Fatalf("%d rows still pending", len(w.pending))
+	}
+}
+
+func TestDBLogWriterSplitFailedBatch(t *testing.T) {
+	db := openTestDB(t)
+	// 已存在的表带有约束，dltag为bad的记录无法写入
+	_, err := db.Exec("CREATE TABLE `app_log` (`id` INTEGER PRIMARY KEY AUTOINCREMENT,`log_time` DATETIME NOT NULL," +
+		"`level` VARCHAR(8) NOT NULL,`dltag` VARCHAR(128) NOT NULL DEFAULT '' CHECK (`dltag` != 'bad')," +
+		"`traceid` VARCHAR(64) NOT NULL DEFAULT '',`spanid` VARCHAR(32) NOT NULL DEFAULT ''," +
+		"`caller` VARCHAR(255) NOT NULL DEFAULT '',`message` TEXT,`fields` TEXT)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewDBLogWriter(db, DBLogDialectSqlite, "app_log")
+	w.SetBatchSize(10)
+	if err = w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	w.pending = testLogRows(15, 3)
+
+	// 第一次失败保留整批等待重试
+	if err = w.Flush(); err == nil {
+		t.Fatal("batch with a bad row was inserted")
+	}
+	if n := countLogRows(t, db, "app_log"); n != 0 || len(w.pending) != 15 {
+		t.Fatalf("after first failure: %d rows inserted, %d pending", n, len(w.pending))
+	}
+
+	// 重试仍失败时逐条写入，只丢弃坏数据，之后的批次正常写入
+	w.retryAt = time.Time{}
+	err = w.Flush()
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 rows") {
+		t.Fatalf("retry error = %v", err)
+	}
+	if n := countLogRows(t, db, "app_log"); n != 14 || len(w.pending) != 0 {
+		t.Fatalf("after retry: %d rows inserted, %d pending", n, len(w.pending))
+	}
+	var bad int
+	if err = db.QueryRow("SELECT COUNT(*) FROM `app_log` WHERE `message` = 'row-003'").Scan(&bad); err != nil || bad != 0 {
+		t.Fatalf("bad row inserted: %d %v", bad, err)
+	}
+
+	w.pending = testLogRows(1, -1)
+	if err = w.Flush(); err != nil {
+		t.Fatalf("flush after drop: %v", err)
+	}
+	if w.retried {
+		t.Fatal("retry state not reset")
+	}
+}
+
+func TestDBLogWriterBackoff(t *testing.T) {
+	db := openTestDB(t)
+	l, _ := logtest.NewLogger()
+	w := NewDBLogWriter(db, DBLogDialectSqlite, "app_log")
+	w.SetBatchSize(1)
+	l.Register(w)
+	defer l.Close()
+
+	if _, err := db.Exec("DROP TABLE `app_log`"); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("first")
+	if !w.retried || w.backoff != db_log_backoff_min {
+		t.Fatalf("retried=%v backoff=%v after failed insert", w.retried, w.backoff)
+	}
+	retryAt := w.retryAt
+
+	// 退避期间Write和Flush都不重试，记录保留在pending中
+	for i := 0; i < 10; i++ {
+		l.Info("during backoff %d", i)
+	}
+	if len(w.pending) != 11 || w.retryAt != retryAt {
+		t.Fatalf("pending=%d retryAt changed=%v", len(w.pending), w.retryAt != retryAt)
+	}
+
+	// 退避结束后由Flush重试，表恢复后全部写入
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	w.retryAt = time.Now()
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countLogRows(t, db, "app_log"); n != 11 || w.retried || w.backoff != 0 {
+		t.Fatalf("rows=%d retried=%v backoff=%v", n, w.retried, w.backoff)
+	}
+}
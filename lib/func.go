@@ -107,11 +107,12 @@ func Destroy() {
 	log.Println("------------------------------------------------------------------------")
 	log.Printf("[INFO] %s\n", " start destroy resources.")
 	CloseDB()
-	log2.Close()
+	log2.CloseAll()
 	log.Printf("[INFO] %s\n", " success destroy resources.")
 }
 
 func HttpGET(trace *TraceContext, urlString string, urlParams url.Values, msTimeout int, header http.Header) (*http.Response, []byte, error) {
+	logger := Log.AddCallerSkip(1)
 	startTime := time.Now().UnixNano()
 	client := http.Client{
 		Timeout: time.Duration(msTimeout) * time.Millisecond,
@@ -119,7 +120,7 @@ func HttpGET(trace *TraceContext, urlString string, urlParams url.Values, msTime
 	urlString = AddGetDataToUrl(urlString, urlParams)
 	req, err := http.NewRequest("GET", urlString, nil)
 	if err != nil {
-		Log.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
+		logger.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
 			"url":       urlString,
 			"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 			"method":    "GET",
@@ -134,7 +135,7 @@ func HttpGET(trace *TraceContext, urlString string, urlParams url.Values, msTime
 	req = addTrace2Header(req, trace)
 	resp, err := client.Do(req)
 	if err != nil {
-		Log.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
+		logger.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
 			"url":       urlString,
 			"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 			"method":    "GET",
@@ -146,7 +147,7 @@ func HttpGET(trace *TraceContext, urlString string, urlParams url.Values, msTime
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		Log.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
+		logger.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
 			"url":       urlString,
 			"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 			"method":    "GET",
@@ -156,7 +157,7 @@ func HttpGET(trace *TraceContext, urlString string, urlParams url.Values, msTime
 		})
 		return nil, nil, err
 	}
-	Log.TagInfo(trace, DLTagHTTPSuccess, map[string]interface{}{
+	logger.TagInfo(trace, DLTagHTTPSuccess, map[string]interface{}{
 		"url":       urlString,
 		"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 		"method":    "GET",
@@ -167,6 +168,7 @@ func HttpGET(trace *TraceContext, urlString string, urlParams url.Values, msTime
 }
 
 func HttpPOST(trace *TraceContext, urlString string, urlParams url.Values, msTimeout int, header http.Header, contextType string) (*http.Response, []byte, error) {
+	logger := Log.AddCallerSkip(1)
 	startTime := time.Now().UnixNano()
 	client := http.Client{
 		Timeout: time.Duration(msTimeout) * time.Millisecond,
@@ -182,7 +184,7 @@ func HttpPOST(trace *TraceContext, urlString string, urlParams url.Values, msTim
 	req.Header.Set("Content-Type", contextType)
 	resp, err := client.Do(req)
 	if err != nil {
-		Log.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
+		logger.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
 			"url":       urlString,
 			"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 			"method":    "POST",
@@ -194,7 +196,7 @@ func HttpPOST(trace *TraceContext, urlString string, urlParams url.Values, msTim
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		Log.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
+		logger.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
 			"url":       urlString,
 			"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 			"method":    "POST",
@@ -204,7 +206,7 @@ func HttpPOST(trace *TraceContext, urlString string, urlParams url.Values, msTim
 		})
 		return nil, nil, err
 	}
-	Log.TagInfo(trace, DLTagHTTPSuccess, map[string]interface{}{
+	logger.TagInfo(trace, DLTagHTTPSuccess, map[string]interface{}{
 		"url":       urlString,
 		"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 		"method":    "POST",
@@ -215,6 +217,7 @@ func HttpPOST(trace *TraceContext, urlString string, urlParams url.Values, msTim
 }
 
 func HttpJSON(trace *TraceContext, urlString string, jsonContent string, msTimeout int, header http.Header) (*http.Response, []byte, error) {
+	logger := Log.AddCallerSkip(1)
 	startTime := time.Now().UnixNano()
 	client := http.Client{
 		Timeout: time.Duration(msTimeout) * time.Millisecond,
@@ -227,7 +230,7 @@ func HttpJSON(trace *TraceContext, urlString string, jsonContent string, msTimeo
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := client.Do(req)
 	if err != nil {
-		Log.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
+		logger.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
 			"url":       urlString,
 			"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 			"method":    "POST",
@@ -239,7 +242,7 @@ func HttpJSON(trace *TraceContext, urlString string, jsonContent string, msTimeo
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		Log.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
+		logger.TagWarn(trace, DLTagHTTPFailed, map[string]interface{}{
 			"url":       urlString,
 			"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 			"method":    "POST",
@@ -249,7 +252,7 @@ func HttpJSON(trace *TraceContext, urlString string, jsonContent string, msTimeo
 		})
 		return nil, nil, err
 	}
-	Log.TagInfo(trace, DLTagHTTPSuccess, map[string]interface{}{
+	logger.TagInfo(trace, DLTagHTTPSuccess, map[string]interface{}{
 		"url":       urlString,
 		"proc_time": float32(time.Now().UnixNano()-startTime) / 1.0e9,
 		"method":    "POST",
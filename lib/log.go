@@ -2,7 +2,7 @@ package lib
 
 import (
 	"github.com/xiaka53/DeployAndLog/log"
-	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -23,15 +23,15 @@ const (
 )
 
 const (
-	_dlTag          = "dltag"
-	_traceId        = "traceid"
-	_spanId         = "spanid"
-	_childSpanId    = "cspanid"
+	_dlTag          = log.FieldDLTag
+	_traceId        = log.FieldTraceId
+	_spanId         = log.FieldSpanId
+	_childSpanId    = log.FieldCSpanId
 	_dlTagBizPrefix = "_com_"
 	_dlTagBizUndef  = "_com_undef"
 )
 
-var Log *Logger
+var Log = &Logger{}
 
 type Trace struct {
 	TraceId     string
@@ -48,52 +48,98 @@ type TraceContext struct {
 }
 
 type Logger struct {
+	callerSkip int
+	trace      *TraceContext
+	fields     []log.Field
 }
 
 func (l *Logger) TagInfo(trace *TraceContext, dltag string, m map[string]interface{}) {
-	m[_dlTag] = checkDLTag(dltag)
-	m[_traceId] = trace.TraceId
-	m[_childSpanId] = trace.CSpanId
-	m[_spanId] = trace.SpanId
-	log.Info(parseParams(m))
+	l.tagLog(log.INFO, trace, dltag, m)
 }
 
 func (l *Logger) TagWarn(trace *TraceContext, dltag string, m map[string]interface{}) {
-	m[_dlTag] = checkDLTag(dltag)
-	m[_traceId] = trace.TraceId
-	m[_childSpanId] = trace.CSpanId
-	m[_spanId] = trace.SpanId
-	log.Warn(parseParams(m))
+	l.tagLog(log.WARNING, trace, dltag, m)
 }
 
 func (l *Logger) TagError(trace *TraceContext, dltag string, m map[string]interface{}) {
-	m[_dlTag] = checkDLTag(dltag)
-	m[_traceId] = trace.TraceId
-	m[_childSpanId] = trace.CSpanId
-	m[_spanId] = trace.SpanId
-	log.Error(parseParams(m))
+	l.tagLog(log.ERROR, trace, dltag, m)
 }
 
 func (l *Logger) TagTrace(trace *TraceContext, dltag string, m map[string]interface{}) {
-	m[_dlTag] = checkDLTag(dltag)
-	m[_traceId] = trace.TraceId
-	m[_childSpanId] = trace.CSpanId
-	m[_spanId] = trace.SpanId
-	log.Trace(parseParams(m))
+	l.tagLog(log.TRACE, trace, dltag, m)
 }
 
 func (l *Logger) TagDebug(trace *TraceContext, dltag string, m map[string]interface{}) {
-	m[_dlTag] = checkDLTag(dltag)
-	m[_traceId] = trace.TraceId
-	m[_childSpanId] = trace.CSpanId
-	m[_spanId] = trace.SpanId
-	log.Debug(parseParams(m))
+	l.tagLog(log.DEBUG, trace, dltag, m)
 }
 
 func (l *Logger) Close() {
 	log.Close()
 }
 
+// 返回额外跳过n层调用栈的Logger，封装TagInfo等方法时使用，使日志中的代码位置指向业务代码
+func (l *Logger) AddCallerSkip(n int) *Logger {
+	c := &Logger{}
+	if l != nil {
+		*c = *l
+	}
+	c.callerSkip += n
+	return c
+}
+
+// 返回绑定trace的Logger，TagInfo等方法的trace传nil时使用绑定的trace
+func (l *Logger) WithTrace(trace *TraceContext) *Logger {
+	c := &Logger{}
+	if l != nil {
+		*c = *l
+	}
+	c.trace = trace
+	return c
+}
+
+// 返回绑定字段的Logger，之后的每条日志都带有这些字段，同名字段以调用时传入的map为准
+func (l *Logger) With(fields ...log.Field) *Logger {
+	c := &Logger{}
+	if l != nil {
+		*c = *l
+	}
+	if len(fields) == 0 {
+		return c
+	}
+	bound := append(make([]log.Field, 0, len(c.fields)+len(fields)), c.fields...)
+	for _, f := range fields {
+		replaced := false
+		for i := range bound {
+			if bound[i].Key == f.Key {
+				bound[i] = f
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			bound = append(bound, f)
+		}
+	}
+	c.fields = bound
+	return c
+}
+
+func (l *Logger) tagLog(level int, trace *TraceContext, dltag string, m map[string]interface{}) {
+	var (
+		skip  int
+		bound []log.Field
+	)
+	if l != nil {
+		skip = l.callerSkip
+		bound = l.fields
+		if trace == nil {
+			trace = l.trace
+		}
+	}
+	// 跳过 tagLog 和 TagXXX 两层
+	log.LogDepth(2+skip, level, "", tagFields(trace, dltag, bound, m)...)
+}
+
 // 生成业务dltag
 func CreateBizDLTag(tagName string) string {
 	if tagName == "" {
@@ -119,20 +165,40 @@ func checkDLTag(dltag string) string {
 	return dltag
 }
 
-//map格式化为string
-func parseParams(m map[string]interface{}) string {
-	var dltag string = "_undef"
-	if _dltag, _have := m["dltag"]; _have {
-		if __val, __ok := _dltag.(string); __ok {
-			dltag = __val
+//map转换为日志字段，dltag、traceid、spanid、cspanid在前，其次是绑定的字段
+func tagFields(trace *TraceContext, dltag string, bound []log.Field, m map[string]interface{}) []log.Field {
+	if trace == nil {
+		trace = &TraceContext{}
+	}
+	fields := make([]log.Field, 0, len(bound)+len(m)+4)
+	fields = append(fields,
+		log.String(_dlTag, checkDLTag(dltag)),
+		log.String(_traceId, trace.TraceId),
+		log.String(_spanId, trace.SpanId),
+		log.String(_childSpanId, trace.CSpanId),
+	)
+	for _, f := range bound {
+		switch f.Key {
+		case _dlTag, _traceId, _spanId, _childSpanId:
+			continue
+		}
+		if _, ok := m[f.Key]; ok {
+			continue
 		}
+		fields = append(fields, f)
 	}
-	for _key, _val := range m {
-		if _key == "dltag" {
+	//map按key排序，每行的字段顺序固定
+	keys := make([]string, 0, len(m))
+	for _key := range m {
+		switch _key {
+		case _dlTag, _traceId, _spanId, _childSpanId:
 			continue
 		}
-		dltag = dltag + "||" + fmt.Sprintf("%v=%+v", _key, _val)
+		keys = append(keys, _key)
 	}
-	dltag = strings.Trim(fmt.Sprintf("%q", dltag), "\"")
-	return dltag
+	sort.Strings(keys)
+	for _, _key := range keys {
+		fields = append(fields, log.Any(_key, m[_key]))
+	}
+	return fields
 }
@@ -9,7 +9,9 @@ import (
 	_ "github.com/e421083458/gorm/dialects/mysql"
 	"reflect"
 	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
 	"unicode"
 )
@@ -67,7 +69,9 @@ func InitDBPool(path string) error {
 	if dbpool, err := GetGormPool("default"); err == nil {
 		GORMDefaultPool = dbpool
 	}
-	return nil
+
+	//配置日志的数据表输出
+	return registerDBLogWriters()
 }
 
 func GetDBPool(name string) (*sql.DB, error) {
@@ -95,17 +99,18 @@ func CloseDB() error {
 }
 
 func DBPoolLogQuery(trace *TraceContext, sqlDb *sql.DB, query string, args ...interface{}) (*sql.Rows, error) {
+	logger := Log.AddCallerSkip(1)
 	startExecTime := time.Now()
 	rows, err := sqlDb.Query(query, args...)
 	endExecTime := time.Now()
 	if err != nil {
-		Log.TagError(trace, "_com_mysql_success", map[string]interface{}{
+		logger.TagError(trace, "_com_mysql_success", map[string]interface{}{
 			"sql":       query,
 			"bind":      args,
 			"proc_time": fmt.Sprintf("%f", endExecTime.Sub(startExecTime).Seconds()),
 		})
 	} else {
-		Log.TagInfo(trace, "_com_mysql_success", map[string]interface{}{
+		logger.TagInfo(trace, "_com_mysql_success", map[string]interface{}{
 			"sql":       query,
 			"bind":      args,
 			"proc_time": fmt.Sprintf("%f", endExecTime.Sub(startExecTime).Seconds()),
@@ -124,10 +129,11 @@ type MysqlGormLogger struct {
 // Print format & print log
 func (logger *MysqlGormLogger) Print(values ...interface{}) {
 	message := logger.LogFormatter(values...)
+	tagLog := Log.AddCallerSkip(gormCallerSkip())
 	if message["level"] == "sql" {
-		Log.TagInfo(logger.Trace, "_com_mysql_success", message)
+		tagLog.TagInfo(logger.Trace, "_com_mysql_success", message)
 	} else {
-		Log.TagInfo(logger.Trace, "_com_mysql_failure", message)
+		tagLog.TagInfo(logger.Trace, "_com_mysql_failure", message)
 	}
 }
 
@@ -141,10 +147,11 @@ func (logger *MysqlGormLogger) CtxPrint(s *gorm.DB, values ...interface{}) {
 		return
 	}
 	message := logger.LogFormatter(values...)
+	tagLog := Log.AddCallerSkip(gormCallerSkip())
 	if message["level"] == "sql" {
-		Log.TagInfo(trace, "_com_mysql_success", message)
+		tagLog.TagInfo(trace, "_com_mysql_success", message)
 	} else {
-		Log.TagInfo(trace, "_com_mysql_failure", message)
+		tagLog.TagInfo(trace, "_com_mysql_failure", message)
 	}
 }
 
@@ -220,6 +227,27 @@ func (logger *MysqlGormLogger) LogFormatter(values ...interface{}) (messages map
 	return
 }
 
+// 计算Print/CtxPrint的调用方到业务代码之间gorm和lib内部的调用栈层数
+func gormCallerSkip() int {
+	var (
+		pcs     = make([]uintptr, 32)
+		gormPkg = reflect.TypeOf(gorm.DB{}).PkgPath() + "."
+		libPkg  = reflect.TypeOf(Logger{}).PkgPath() + "."
+	)
+	// 跳过 runtime.Callers、gormCallerSkip、Print
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for skip := 1; ; skip++ {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, gormPkg) && !strings.HasPrefix(frame.Function, libPkg) {
+			return skip
+		}
+		if !more {
+			return 1
+		}
+	}
+}
+
 func (logger *MysqlGormLogger) NowFunc() time.Time {
 	return time.Now()
 }
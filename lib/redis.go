@@ -57,7 +57,9 @@ func InitRedisPool(path string) error {
 			RedisDefaultPool = defaultpool
 		}
 	}
-	return nil
+
+	//配置日志的redis输出
+	return registerRedisLogWriters()
 }
 
 // 获取链接池
@@ -82,10 +84,11 @@ func RedisConnFactory(name string) (redis.Conn, error) {
 
 // 关闭一个链接
 func RedisConnClose(trace *TraceContext, conn redis.Conn) {
+	logger := Log.AddCallerSkip(1)
 	startExecTime := time.Now()
 	if err := conn.Close(); err != nil {
 		endExecTime := time.Now()
-		Log.TagError(trace, "_com_redis_failure", map[string]interface{}{
+		logger.TagError(trace, "_com_redis_failure", map[string]interface{}{
 			"err":       errors.New("RedisConnCloseError"),
 			"proc_time": fmt.Sprintf("%fs", endExecTime.Sub(startExecTime).Seconds()),
 		})
@@ -94,11 +97,12 @@ func RedisConnClose(trace *TraceContext, conn redis.Conn) {
 }
 
 func RedisLogDo(trace *TraceContext, c redis.Conn, commandName string, args ...interface{}) (interface{}, error) {
+	logger := Log.AddCallerSkip(1)
 	startExecTime := time.Now()
 	reply, err := c.Do(commandName, args...)
 	endExecTime := time.Now()
 	if err != nil {
-		Log.TagError(trace, "_com_redis_failure", map[string]interface{}{
+		logger.TagError(trace, "_com_redis_failure", map[string]interface{}{
 			"method":    commandName,
 			"err":       err,
 			"bind":      args,
@@ -106,7 +110,7 @@ func RedisLogDo(trace *TraceContext, c redis.Conn, commandName string, args ...i
 		})
 	} else {
 		replyStr, _ := redis.String(reply, nil)
-		Log.TagInfo(trace, "_com_redis_success", map[string]interface{}{
+		logger.TagInfo(trace, "_com_redis_success", map[string]interface{}{
 			"method":    commandName,
 			"bind":      args,
 			"reply":     replyStr,
@@ -118,9 +122,10 @@ func RedisLogDo(trace *TraceContext, c redis.Conn, commandName string, args ...i
 
 // 通过配置 执行redis
 func RedisConfDo(trace *TraceContext, name string, commandName string, args ...interface{}) (interface{}, error) {
+	logger := Log.AddCallerSkip(1)
 	c, err := RedisConnFactory(name)
 	if err != nil {
-		Log.TagError(trace, "_com_redis_failure", map[string]interface{}{
+		logger.TagError(trace, "_com_redis_failure", map[string]interface{}{
 			"method": commandName,
 			"err":    errors.New("RedisConnFactory_error:" + name),
 			"bind":   args,
@@ -133,7 +138,7 @@ func RedisConfDo(trace *TraceContext, name string, commandName string, args ...i
 	reply, err := c.Do(commandName, args...)
 	endExecTime := time.Now()
 	if err != nil {
-		Log.TagError(trace, "_com_redis_failure", map[string]interface{}{
+		logger.TagError(trace, "_com_redis_failure", map[string]interface{}{
 			"method":    commandName,
 			"err":       err,
 			"bind":      args,
@@ -141,7 +146,7 @@ func RedisConfDo(trace *TraceContext, name string, commandName string, args ...i
 		})
 	} else {
 		replyStr, _ := redis.String(reply, nil)
-		Log.TagInfo(trace, "_com_redis_success", map[string]interface{}{
+		logger.TagInfo(trace, "_com_redis_success", map[string]interface{}{
 			"method":    commandName,
 			"bind":      args,
 			"reply":     replyStr,
@@ -0,0 +1,146 @@
+package lib
+
+import (
+	"errors"
+	"github.com/gomodule/redigo/redis"
+	"github.com/xiaka53/DeployAndLog/log"
+	"strings"
+)
+
+const (
+	RedisLogModeList   = "list"
+	RedisLogModeStream = "stream"
+)
+
+const (
+	redis_log_batch_size_default = 100
+	redis_log_max_len_default    = 100000
+)
+
+// 以JSON格式将日志写入redis list(LPUSH+LTRIM)或stream(XADD MAXLEN)，批量通过pipeline发送
+// 直接使用连接执行命令，不经过RedisLogDo，避免日志写入再产生日志
+type RedisLogWriter struct {
+	poolName  string
+	pool      *redis.Pool
+	mode      string
+	key       string
+	maxLen    int
+	batchSize int
+	formatter log.Formatter
+	pending   []string
+}
+
+func NewRedisLogWriter(poolName, mode, key string) *RedisLogWriter {
+	return &RedisLogWriter{
+		poolName:  poolName,
+		mode:      mode,
+		key:       key,
+		maxLen:    redis_log_max_len_default,
+		batchSize: redis_log_batch_size_default,
+		formatter: &log.JSONFormatter{},
+	}
+}
+
+// list或stream保留的最大条数
+func (w *RedisLogWriter) SetMaxLen(n int) {
+	if n > 0 {
+		w.maxLen = n
+	}
+}
+
+func (w *RedisLogWriter) SetBatchSize(n int) {
+	if n > 0 {
+		w.batchSize = n
+	}
+}
+
+func (w *RedisLogWriter) Init() (err error) {
+	switch w.mode {
+	case RedisLogModeList, RedisLogModeStream:
+	default:
+		return errors.New("Invalid redis log mode (" + w.mode + ")")
+	}
+	if w.key == "" {
+		return errors.New("redis log key is empty")
+	}
+	if w.pool, err = GetRedisPool(w.poolName); err != nil {
+		return errors.New("redis log pool not found: " + w.poolName)
+	}
+	return
+}
+
+func (w *RedisLogWriter) Write(r *log.Record) error {
+	w.pending = append(w.pending, strings.TrimRight(w.formatter.Format(r), "\n"))
+	if len(w.pending) >= w.batchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// 发送失败的批次直接丢弃，由writer的错误计数体现
+func (w *RedisLogWriter) Flush() (err error) {
+	if len(w.pending) == 0 {
+		return
+	}
+	lines := w.pending
+	w.pending = nil
+
+	c := w.pool.Get()
+	defer c.Close()
+	if w.mode == RedisLogModeList {
+		args := make([]interface{}, 0, len(lines)+1)
+		args = append(args, w.key)
+		for _, line := range lines {
+			args = append(args, line)
+		}
+		c.Send("LPUSH", args...)
+		c.Send("LTRIM", w.key, 0, w.maxLen-1)
+	} else {
+		for _, line := range lines {
+			c.Send("XADD", w.key, "MAXLEN", "~", w.maxLen, "*", "data", line)
+		}
+	}
+	replies, err := redis.Values(c.Do(""))
+	if err != nil {
+		return
+	}
+	for _, reply := range replies {
+		if e, ok := reply.(redis.Error); ok {
+			return e
+		}
+	}
+	return
+}
+
+//按[log.redis_writer]注册，需要在redis连接池初始化之后
+func registerRedisLogWriters() error {
+	if ConfBase == nil {
+		return nil
+	}
+	if err := registerRedisLogWriter(log.Default(), ConfBase.Log.RW); err != nil {
+		return err
+	}
+	for name, conf := range ConfBase.Log.Loggers {
+		if err := registerRedisLogWriter(log.Get(name), conf.RW); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func registerRedisLogWriter(logger *log.Logger, conf LogConfRedisWriter) error {
+	if !conf.On {
+		return nil
+	}
+	if conf.Pool == "" {
+		conf.Pool = "default"
+	}
+	if conf.Mode == "" {
+		conf.Mode = RedisLogModeList
+	}
+	w := NewRedisLogWriter(conf.Pool, conf.Mode, conf.Key)
+	w.SetMaxLen(conf.MaxLen)
+	w.SetBatchSize(conf.BatchSize)
+	logger.Register(w)
+	return nil
+}
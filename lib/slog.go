@@ -0,0 +1,18 @@
+package lib
+
+import (
+	"context"
+	"github.com/xiaka53/DeployAndLog/log"
+	"log/slog"
+)
+
+// 写入default Logger的slog.Handler
+// dltag、traceid、spanid、cspanid与TagInfo等方法的输出一致，context中没有TraceContext时trace字段为空
+// dltag通过属性传入，如 slog.InfoContext(ctx, "msg", "dltag", lib.DLTagRequestIn)，未传入时为_undef
+func NewSlogHandler() slog.Handler {
+	return log.NewSlogHandler(nil).WithContextFields(slogTraceFields)
+}
+
+func slogTraceFields(ctx context.Context) []log.Field {
+	return tagFields(GetTraceContext(ctx), DLTagUndefind, nil, nil)
+}
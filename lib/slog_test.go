@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"context"
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"log/slog"
+	"testing"
+)
+
+// slog与TagInfo输出相同的字段
+func TestSlogHandlerTraceFields(t *testing.T) {
+	rec, restore := logtest.CaptureDefault()
+	trace := &TraceContext{Trace: Trace{TraceId: "t1", SpanId: "s1"}, CSpanId: "c1"}
+	logger := slog.New(NewSlogHandler())
+	logger.InfoContext(context.Background(), "no trace")
+	logger.InfoContext(SetTraceContext(context.Background(), trace), "with trace", "dltag", DLTagRequestIn)
+	Log.TagInfo(nil, DLTagUndefind, nil)
+	restore()
+
+	entries := rec.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	want := [][4]string{
+		{DLTagUndefind, "", "", ""},
+		{DLTagRequestIn, "t1", "s1", "c1"},
+		{DLTagUndefind, "", "", ""},
+	}
+	for i, e := range entries {
+		if len(e.Fields) < 4 {
+			t.Fatalf("entry %s has no trace fields", e)
+		}
+		for j, key := range []string{log.FieldDLTag, log.FieldTraceId, log.FieldSpanId, log.FieldCSpanId} {
+			if f := e.Fields[j]; f.Key != key || f.Text() != want[i][j] {
+				t.Errorf("entry %d field %d = %s=%s, want %s=%s", i, j, f.Key, f.Text(), key, want[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package lib
+
+import (
+	"github.com/xiaka53/DeployAndLog/log"
+	stdlog "log"
+)
+
+// 按行写入default Logger的io.Writer，每行一条日志，带dltag
+// 如 exec.Cmd 的 Stderr、第三方库的日志输出
+func NewLogWriter(level int, dltag string) *log.LineWriter {
+	return log.NewLineWriter(nil, level, log.String(_dlTag, checkDLTag(dltag)))
+}
+
+// 写入default Logger的标准库*log.Logger，带dltag
+func NewStdLogger(level int, dltag string) *stdlog.Logger {
+	return log.NewStdLogger(nil, level, log.String(_dlTag, checkDLTag(dltag)))
+}
+
+// 将标准库log的默认输出重定向到default Logger，返回恢复原设置的函数
+func RedirectStdLog(level int, dltag string) func() {
+	return log.RedirectStdLog(nil, level, log.String(_dlTag, checkDLTag(dltag)))
+}
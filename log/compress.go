@@ -0,0 +1,71 @@
+package log
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+)
+
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+
+	gzipExt = ".gz"
+	zstdExt = ".zst"
+)
+
+// 压缩文件为 src+扩展名，成功后删除源文件
+func compressFile(src string, method string) (dst string, err error) {
+	var (
+		in  *os.File
+		out *os.File
+		zw  io.WriteCloser
+	)
+
+	switch method {
+	case CompressGzip:
+		dst = src + gzipExt
+	case CompressZstd:
+		dst = src + zstdExt
+	default:
+		return "", errors.New("Invalid compress method (" + method + ")")
+	}
+
+	if in, err = os.Open(src); err != nil {
+		return
+	}
+	defer in.Close()
+
+	if out, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+	}()
+
+	if method == CompressGzip {
+		zw = gzip.NewWriter(out)
+	} else if zw, err = zstd.NewWriter(out); err != nil {
+		return
+	}
+
+	if _, err = io.Copy(zw, in); err != nil {
+		zw.Close()
+		return
+	}
+	if err = zw.Close(); err != nil {
+		return
+	}
+	if err = out.Close(); err != nil {
+		return
+	}
+
+	in.Close()
+	err = os.Remove(src)
+	return
+}
@@ -1,7 +1,7 @@
 package log
 
 import (
-	"errors"
+	"time"
 )
 
 type ConfFileWriter struct {
@@ -10,24 +10,133 @@ type ConfFileWriter struct {
 	RotateLogPath   string `toml:"RotateLogPath"`
 	WfLogPath       string `toml:"WfLogPath"`
 	RotateWfLogPath string `toml:"RotateWfLogPath"`
+	Format          string `toml:"Format"`
+	MaxSizeMB       int    `toml:"MaxSizeMB"`
+	MaxBackups      int    `toml:"MaxBackups"`
+	MaxAgeDays      int    `toml:"MaxAgeDays"`
+	MaxTotalMB      int    `toml:"MaxTotalMB"`
+	Compress        string `toml:"Compress"`
 }
 
 type ConfConsoleWriter struct {
-	On    bool `toml:"On"`
-	Color bool `toml:"Color"`
+	On     bool   `toml:"On"`
+	Color  bool   `toml:"Color"`
+	Format string `toml:"Format"`
+}
+
+type ConfSyslogWriter struct {
+	On       bool   `toml:"On"`
+	Network  string `toml:"Network"`
+	Addr     string `toml:"Addr"`
+	Facility string `toml:"Facility"`
+	AppName  string `toml:"AppName"`
+	Format   string `toml:"Format"`
+}
+
+type ConfNetWriter struct {
+	On         bool   `toml:"On"`
+	Network    string `toml:"Network"`
+	Addr       string `toml:"Addr"`
+	Format     string `toml:"Format"`
+	BufferKB   int    `toml:"BufferKB"`
+	SpillPath  string `toml:"SpillPath"`
+	MaxSpillMB int    `toml:"MaxSpillMB"`
+}
+
+type ConfHTTPWriter struct {
+	On              bool              `toml:"On"`
+	Mode            string            `toml:"Mode"`
+	Url             string            `toml:"Url"`
+	Index           string            `toml:"Index"`
+	Env             string            `toml:"Env"`
+	Labels          map[string]string `toml:"Labels"`
+	OTLPEncoding    string            `toml:"OTLPEncoding"`
+	Resource        map[string]string `toml:"Resource"`
+	Format          string            `toml:"Format"`
+	BatchSize       int               `toml:"BatchSize"`
+	FlushIntervalMs int               `toml:"FlushIntervalMs"`
+	MaxRetries      int               `toml:"MaxRetries"`
+	MaxInFlight     int               `toml:"MaxInFlight"`
+	TimeoutMs       int               `toml:"TimeoutMs"`
+	Gzip            bool              `toml:"Gzip"`
+}
+
+type ConfWebhookWriter struct {
+	On            bool   `toml:"On"`
+	Kind          string `toml:"Kind"`
+	Url           string `toml:"Url"`
+	Secret        string `toml:"Secret"`
+	Template      string `toml:"Template"`
+	LevelFloor    string `toml:"LevelFloor"`
+	LevelCeil     string `toml:"LevelCeil"`
+	RatePerMinute int    `toml:"RatePerMinute"`
+	WindowSec     int    `toml:"WindowSec"`
+}
+
+type ConfRingWriter struct {
+	On         bool `toml:"On"`
+	MaxRecords int  `toml:"MaxRecords"`
+	MaxMB      int  `toml:"MaxMB"`
+}
+
+type ConfRedactRule struct {
+	Keys    []string `toml:"Keys"`
+	Pattern string   `toml:"Pattern"`
+	DLTags  []string `toml:"DLTags"`
+	Style   string   `toml:"Style"`
+	HashKey string   `toml:"HashKey"`
 }
 
 type LogConfig struct {
-	Level string            `toml:"LogLevel"`
-	FW    ConfFileWriter    `toml:"FileWriter"`
-	CW    ConfConsoleWriter `toml:"ConsoleWriter"`
+	Level           string            `toml:"LogLevel"`
+	Layout          string            `toml:"Layout"`
+	CallerFunc      bool              `toml:"CallerFunc"`
+	FieldOrder      []string          `toml:"FieldOrder"`
+	SortFields      bool              `toml:"SortFields"`
+	Redact          []ConfRedactRule  `toml:"Redact"`
+	WriterQueueSize int               `toml:"WriterQueueSize"`
+	TunnelSize      int               `toml:"TunnelSize"`
+	OverflowPolicy  string            `toml:"OverflowPolicy"`
+	BlockTimeoutMs  int               `toml:"BlockTimeoutMs"`
+	FW              ConfFileWriter    `toml:"FileWriter"`
+	CW              ConfConsoleWriter `toml:"ConsoleWriter"`
+	SW              ConfSyslogWriter  `toml:"SyslogWriter"`
+	NW              ConfNetWriter     `toml:"NetWriter"`
+	HW              []ConfHTTPWriter  `toml:"HTTPWriter"`
+	WW              ConfWebhookWriter `toml:"WebhookWriter"`
+	RingW           ConfRingWriter    `toml:"RingWriter"`
 }
 
 func SetupLogInstanceWithConf(lc LogConfig, logger *Logger) (err error) {
+	var policy int
+	if policy, err = ParseOverflowPolicy(lc.OverflowPolicy); err != nil {
+		return
+	}
+	logger.SetOverflowPolicy(policy, time.Duration(lc.BlockTimeoutMs)*time.Millisecond)
+	logger.SetTunnelSize(lc.TunnelSize)
+	logger.SetWriterQueueSize(lc.WriterQueueSize)
+	if lc.Layout != "" {
+		logger.SetLayout(lc.Layout)
+	}
+	logger.SetCallerFunc(lc.CallerFunc)
+	logger.SetFieldOrder(lc.FieldOrder, lc.SortFields)
+	if err = setupRedactor(logger, lc.Redact); err != nil {
+		return
+	}
+
 	if lc.FW.On {
+		var f Formatter
+		if f, err = NewFormatter(lc.FW.Format); err != nil {
+			return
+		}
+
 		if len(lc.FW.LogPath) > 0 {
 			w := NewFileWriter()
 			w.SetFileName(lc.FW.LogPath)
+			w.SetFormatter(f)
+			if err = setupFileRetention(w, lc.FW); err != nil {
+				return
+			}
 			w.SetPathPattern(lc.FW.RotateLogPath)
 			w.SetLogLevelFloor(TRACE)
 			if len(lc.FW.WfLogPath) > 0 {
@@ -41,6 +150,10 @@ func SetupLogInstanceWithConf(lc LogConfig, logger *Logger) (err error) {
 		if len(lc.FW.WfLogPath) > 0 {
 			wfw := NewFileWriter()
 			wfw.SetFileName(lc.FW.WfLogPath)
+			wfw.SetFormatter(f)
+			if err = setupFileRetention(wfw, lc.FW); err != nil {
+				return
+			}
 			wfw.SetPathPattern(lc.FW.RotateWfLogPath)
 			wfw.SetLogLevelFloor(WARNING)
 			wfw.SetLogLevelCeil(ERROR)
@@ -51,34 +164,156 @@ func SetupLogInstanceWithConf(lc LogConfig, logger *Logger) (err error) {
 	if lc.CW.On {
 		w := NewConsoleWriter()
 		w.SetColor(lc.CW.Color)
+		// 文本格式时沿用color配置
+		if lc.CW.Format != "" && lc.CW.Format != "text" {
+			var f Formatter
+			if f, err = NewFormatter(lc.CW.Format); err != nil {
+				return
+			}
+			w.SetFormatter(f)
+		}
 		logger.Register(w)
 	}
-	switch lc.Level {
-	case "trace":
-		logger.SetLevel(TRACE)
 
-	case "debug":
-		logger.SetLevel(DEBUG)
-
-	case "info":
-		logger.SetLevel(INFO)
+	if lc.SW.On {
+		w := NewSyslogWriter()
+		w.SetAddr(lc.SW.Network, lc.SW.Addr)
+		w.SetAppName(lc.SW.AppName)
+		var facility int
+		if facility, err = ParseFacility(lc.SW.Facility); err != nil {
+			return
+		}
+		w.SetFacility(facility)
+		if lc.SW.Format != "" && lc.SW.Format != "text" {
+			var f Formatter
+			if f, err = NewFormatter(lc.SW.Format); err != nil {
+				return
+			}
+			w.SetFormatter(f)
+		}
+		logger.Register(w)
+	}
 
-	case "warning":
-		logger.SetLevel(WARNING)
+	if lc.NW.On {
+		var f Formatter
+		if f, err = NewFormatter(lc.NW.Format); err != nil {
+			return
+		}
+		w := NewNetWriter()
+		w.SetAddr(lc.NW.Network, lc.NW.Addr)
+		w.SetFormatter(f)
+		w.SetBufferSize(lc.NW.BufferKB << 10)
+		w.SetSpillPath(lc.NW.SpillPath)
+		w.SetMaxSpillSize(int64(lc.NW.MaxSpillMB) << 20)
+		logger.Register(w)
+	}
 
-	case "error":
-		logger.SetLevel(ERROR)
+	//可同时配置多个，如分别发送到Elasticsearch、Loki和OTLP
+	for _, hw := range lc.HW {
+		if !hw.On {
+			continue
+		}
+		w := NewHTTPWriter()
+		w.SetEndpoint(hw.Mode, hw.Url)
+		w.SetIndex(hw.Index)
+		if hw.Env != "" {
+			w.SetLabel("env", hw.Env)
+		}
+		for k, v := range hw.Labels {
+			w.SetLabel(k, v)
+		}
+		w.SetOTLPEncoding(hw.OTLPEncoding)
+		for k, v := range hw.Resource {
+			w.SetResource(k, v)
+		}
+		if hw.Format != "" && hw.Format != "text" {
+			var f Formatter
+			if f, err = NewFormatter(hw.Format); err != nil {
+				return
+			}
+			w.SetFormatter(f)
+		}
+		w.SetBatch(hw.BatchSize, time.Duration(hw.FlushIntervalMs)*time.Millisecond)
+		if hw.MaxRetries > 0 {
+			w.SetMaxRetries(hw.MaxRetries)
+		}
+		w.SetMaxInFlight(hw.MaxInFlight)
+		w.SetTimeout(time.Duration(hw.TimeoutMs) * time.Millisecond)
+		w.SetGzip(hw.Gzip)
+		logger.Register(w)
+	}
 
-	case "fatal":
-		logger.SetLevel(FATAL)
+	if lc.WW.On {
+		w := NewWebhookWriter()
+		w.SetWebhook(lc.WW.Kind, lc.WW.Url)
+		w.SetSecret(lc.WW.Secret)
+		if err = w.SetTemplate(lc.WW.Template); err != nil {
+			return
+		}
+		var floor, ceil int
+		if floor, err = parseLevelOr(lc.WW.LevelFloor, ERROR); err != nil {
+			return
+		}
+		if ceil, err = parseLevelOr(lc.WW.LevelCeil, FATAL); err != nil {
+			return
+		}
+		w.SetLogLevelFloor(floor)
+		w.SetLogLevelCeil(ceil)
+		w.SetRateLimit(lc.WW.RatePerMinute)
+		w.SetWindow(time.Duration(lc.WW.WindowSec) * time.Second)
+		logger.Register(w)
+	}
 
-	default:
-		err = errors.New("Invalid log level")
+	if lc.RingW.On {
+		w := NewRingWriter()
+		if lc.RingW.MaxRecords > 0 || lc.RingW.MaxMB > 0 {
+			w.SetMaxRecords(lc.RingW.MaxRecords)
+			w.SetMaxBytes(lc.RingW.MaxMB << 20)
+		}
+		logger.Register(w)
+	}
+	var lvl int
+	if lvl, err = ParseLevel(lc.Level); err != nil {
+		return
 	}
+	logger.SetLevel(lvl)
 	return
 }
 
+// 未配置时使用默认级别
+func parseLevelOr(name string, def int) (int, error) {
+	if name == "" {
+		return def, nil
+	}
+	return ParseLevel(name)
+}
+
+func setupFileRetention(w *FileWriter, fw ConfFileWriter) error {
+	w.SetMaxSize(int64(fw.MaxSizeMB) << 20)
+	w.SetMaxBackups(fw.MaxBackups)
+	w.SetMaxAge(time.Duration(fw.MaxAgeDays) * 24 * time.Hour)
+	w.SetMaxTotalSize(int64(fw.MaxTotalMB) << 20)
+	return w.SetCompress(fw.Compress)
+}
+
+// 没有规则时关闭脱敏
+func setupRedactor(logger *Logger, confs []ConfRedactRule) error {
+	if len(confs) == 0 {
+		logger.SetRedactor(nil)
+		return nil
+	}
+	rules := make([]RedactRule, 0, len(confs))
+	for _, c := range confs {
+		rules = append(rules, RedactRule{Keys: c.Keys, Pattern: c.Pattern, DLTags: c.DLTags, Style: c.Style, HashKey: c.HashKey})
+	}
+	r, err := NewRedactor(rules)
+	if err != nil {
+		return err
+	}
+	logger.SetRedactor(r)
+	return nil
+}
+
 func SetupDefaultLogWithConf(lc LogConfig) (err error) {
-	defaultLoggerInit()
-	return SetupLogInstanceWithConf(lc, logger_default)
+	return SetupLogInstanceWithConf(lc, Default())
 }
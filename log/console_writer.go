@@ -11,33 +11,34 @@ func (r *colorRecord) String() string {
 	switch r.level {
 	case TRACE:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[34m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], (*Record)(r).caller(), (*Record)(r).body())
 	case DEBUG:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[34m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], (*Record)(r).caller(), (*Record)(r).body())
 
 	case INFO:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[32m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], (*Record)(r).caller(), (*Record)(r).body())
 
 	case WARNING:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[33m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], (*Record)(r).caller(), (*Record)(r).body())
 
 	case ERROR:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[31m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], (*Record)(r).caller(), (*Record)(r).body())
 
 	case FATAL:
 		return fmt.Sprintf("\033[36m%s\033[0m [\033[35m%s\033[0m] \033[47;30m%s\033[0m %s\n",
-			r.time, LEVEL_FLAGS[r.level], r.code, r.info)
+			r.time, LEVEL_FLAGS[r.level], (*Record)(r).caller(), (*Record)(r).body())
 	}
 
 	return ""
 }
 
 type ConsoleWriter struct {
-	color bool
+	color     bool
+	formatter Formatter
 }
 
 func NewConsoleWriter() *ConsoleWriter {
@@ -45,7 +46,9 @@ func NewConsoleWriter() *ConsoleWriter {
 }
 
 func (w *ConsoleWriter) Write(r *Record) error {
-	if w.color {
+	if w.formatter != nil {
+		fmt.Fprint(os.Stdout, w.formatter.Format(r))
+	} else if w.color {
 		fmt.Fprint(os.Stdout, ((*colorRecord)(r)).String())
 	} else {
 		fmt.Fprint(os.Stdout, r.String())
@@ -60,3 +63,7 @@ func (w *ConsoleWriter) Init() error {
 func (w *ConsoleWriter) SetColor(c bool) {
 	w.color = c
 }
+
+func (w *ConsoleWriter) SetFormatter(f Formatter) {
+	w.formatter = f
+}
@@ -0,0 +1,133 @@
+package log
+
+import (
+	"fmt"
+	"time"
+)
+
+type FieldType uint8
+
+const (
+	AnyType FieldType = iota
+	StringType
+	IntType
+	FloatType
+	DurationType
+	ErrorType
+	MapType
+)
+
+// 链路相关的一级字段
+const (
+	FieldDLTag   = "dltag"
+	FieldTraceId = "traceid"
+	FieldSpanId  = "spanid"
+	FieldCSpanId = "cspanid"
+)
+
+type Field struct {
+	Key   string
+	Type  FieldType
+	Value interface{}
+}
+
+func String(key string, val string) Field {
+	return Field{Key: key, Type: StringType, Value: val}
+}
+
+func Int(key string, val int) Field {
+	return Field{Key: key, Type: IntType, Value: val}
+}
+
+func Int64(key string, val int64) Field {
+	return Field{Key: key, Type: IntType, Value: val}
+}
+
+func Float64(key string, val float64) Field {
+	return Field{Key: key, Type: FloatType, Value: val}
+}
+
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, Type: DurationType, Value: val}
+}
+
+func Err(key string, err error) Field {
+	return Field{Key: key, Type: ErrorType, Value: err}
+}
+
+func Map(key string, val map[string]interface{}) Field {
+	return Field{Key: key, Type: MapType, Value: val}
+}
+
+// 根据值的实际类型生成Field
+func Any(key string, val interface{}) Field {
+	switch v := val.(type) {
+	case string:
+		return String(key, v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return Field{Key: key, Type: IntType, Value: v}
+	case float32, float64:
+		return Field{Key: key, Type: FloatType, Value: v}
+	case time.Duration:
+		return Duration(key, v)
+	case error:
+		return Err(key, v)
+	case map[string]interface{}:
+		return Map(key, v)
+	}
+	return Field{Key: key, Type: AnyType, Value: val}
+}
+
+// 文本格式下的值
+func (f Field) Text() string {
+	switch f.Type {
+	case StringType:
+		return f.Value.(string)
+	case ErrorType:
+		if f.Value == nil {
+			return "<nil>"
+		}
+	}
+	return fmt.Sprintf("%+v", f.Value)
+}
+
+// 用于json编码的值
+func (f Field) JSONValue() interface{} {
+	switch f.Type {
+	case DurationType:
+		return f.Value.(time.Duration).String()
+
+	case ErrorType:
+		if f.Value == nil {
+			return nil
+		}
+		return f.Value.(error).Error()
+
+	case MapType:
+		m := f.Value.(map[string]interface{})
+		out := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			out[k] = Any(k, v).JSONValue()
+		}
+		return out
+	}
+	return f.Value
+}
+
+// 同名字段覆盖原位置的值，其余追加在后面
+func mergeFields(fields []Field, more []Field) []Field {
+	for _, f := range more {
+		replaced := false
+		for i := range fields {
+			if fields[i].Key == f.Key {
+				fields[i] = f
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
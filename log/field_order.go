@@ -0,0 +1,63 @@
+package log
+
+import (
+	"sort"
+)
+
+// 固定在最前面的字段
+var leadingFieldKeys = []string{FieldDLTag, FieldTraceId, FieldSpanId, FieldCSpanId}
+
+type fieldOrder struct {
+	rank   map[string]int
+	sorted bool
+}
+
+func newFieldOrder(keys []string, sorted bool) *fieldOrder {
+	o := &fieldOrder{rank: make(map[string]int, len(leadingFieldKeys)+len(keys)), sorted: sorted}
+	for _, key := range append(leadingFieldKeys[:len(leadingFieldKeys):len(leadingFieldKeys)], keys...) {
+		if _, ok := o.rank[key]; !ok {
+			o.rank[key] = len(o.rank)
+		}
+	}
+	return o
+}
+
+// 字段的输出顺序：dltag、traceid、spanid、cspanid在前，其次按keys的顺序，
+// 其余字段sorted为true时按key排序，否则保持传入的顺序
+func (l *Logger) SetFieldOrder(keys []string, sorted bool) {
+	l.fieldOrder.Store(newFieldOrder(keys, sorted))
+}
+
+func (o *fieldOrder) rankOf(key string) int {
+	if r, ok := o.rank[key]; ok {
+		return r
+	}
+	return len(o.rank)
+}
+
+func (o *fieldOrder) less(a, b Field) bool {
+	ra, rb := o.rankOf(a.Key), o.rankOf(b.Key)
+	if ra != rb {
+		return ra < rb
+	}
+	return o.sorted && ra == len(o.rank) && a.Key < b.Key
+}
+
+// 已经有序时直接返回，否则排序副本，不修改调用方的切片
+func (o *fieldOrder) apply(fields []Field) []Field {
+	i := 1
+	for ; i < len(fields); i++ {
+		if o.less(fields[i], fields[i-1]) {
+			break
+		}
+	}
+	if i >= len(fields) {
+		return fields
+	}
+	ordered := make([]Field, len(fields))
+	copy(ordered, fields)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return o.less(ordered[i], ordered[j])
+	})
+	return ordered
+}
@@ -7,11 +7,20 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 var pathVariableTable map[byte]func(*time.Time) int
 
+// 备份压缩、清理记录的dltag
+const DLTagLogBackup = "_com_log_backup"
+
 type FileWriter struct {
 	logLevelFloor int
 	logLevelCeil  int
@@ -19,8 +28,21 @@ type FileWriter struct {
 	pathFmt       string
 	file          *os.File
 	fileBufWriter *bufio.Writer
+	formatter     Formatter
+	maxSize       int64
+	size          int64
+	maxBackups    int
+	maxAge        time.Duration
+	maxTotalSize  int64
+	backupGlob    string
+	backupRegexp  *regexp.Regexp
+	compress      string
+	backupMutex   sync.Mutex
+	logger        *Logger
 	actions       []func(*time.Time) int
 	variables     []interface{}
+	// 切分后的文件只写入过备份处理记录
+	noticeOnly bool
 }
 
 func NewFileWriter() *FileWriter {
@@ -43,6 +65,40 @@ func (w *FileWriter) SetLogLevelCeil(ceil int) {
 	w.logLevelCeil = ceil
 }
 
+func (w *FileWriter) SetFormatter(f Formatter) {
+	w.formatter = f
+}
+
+// 单个文件的最大字节数，超过后按序号切分，0表示不限制
+func (w *FileWriter) SetMaxSize(size int64) {
+	w.maxSize = size
+}
+
+// 切分后的文件压缩方式：gzip、zstd，空字符串表示不压缩
+func (w *FileWriter) SetCompress(method string) error {
+	switch method {
+	case "", CompressGzip, CompressZstd:
+		w.compress = method
+		return nil
+	}
+	return errors.New("Invalid compress method (" + method + ")")
+}
+
+// 保留的备份文件个数，0表示不限制
+func (w *FileWriter) SetMaxBackups(n int) {
+	w.maxBackups = n
+}
+
+// 备份文件最长保留时间，0表示不限制
+func (w *FileWriter) SetMaxAge(d time.Duration) {
+	w.maxAge = d
+}
+
+// 备份文件总字节数上限，0表示不限制
+func (w *FileWriter) SetMaxTotalSize(size int64) {
+	w.maxTotalSize = size
+}
+
 func (w *FileWriter) SetPathPattern(pattern string) error {
 	n := 0
 	for _, c := range pattern {
@@ -51,6 +107,12 @@ func (w *FileWriter) SetPathPattern(pattern string) error {
 		}
 	}
 
+	// Glob返回的路径没有./前缀，匹配备份时使用Clean后的pattern
+	if pattern != "" {
+		clean := filepath.Clean(pattern)
+		w.backupGlob = convertPatternToGlob([]byte(clean)) + "*"
+		w.backupRegexp = convertPatternToRegexp(clean)
+	}
 	if n == 0 {
 		w.pathFmt = pattern
 		return nil
@@ -94,10 +156,25 @@ func (w *FileWriter) Write(r *Record) error {
 	if w.fileBufWriter == nil {
 		return errors.New("no opened file")
 	}
-	if _, err := w.fileBufWriter.WriteString(r.String()); err != nil {
-		return err
+	line := ""
+	if w.formatter != nil {
+		line = w.formatter.Format(r)
+	} else {
+		line = r.String()
 	}
-	return nil
+	// 备份处理记录同样计入大小，但只有备份处理记录的文件不再切分，避免切分、清理、记录之间循环
+	notice := isBackupNotice(r)
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(line)) > w.maxSize && !(notice && w.noticeOnly) {
+		if err := w.rotateBySize(); err != nil {
+			return err
+		}
+	}
+	n, err := w.fileBufWriter.WriteString(line)
+	w.size += int64(n)
+	if !notice {
+		w.noticeOnly = false
+	}
+	return err
 }
 
 func (w *FileWriter) CreateLogFile() error {
@@ -113,6 +190,12 @@ func (w *FileWriter) CreateLogFile() error {
 		w.file = file
 	}
 
+	if info, err := w.file.Stat(); err != nil {
+		return err
+	} else {
+		w.size = info.Size()
+	}
+
 	if w.fileBufWriter = bufio.NewWriterSize(w.file, 8192); w.fileBufWriter == nil {
 		return errors.New("new fileBufWriter failed.")
 	}
@@ -141,6 +224,26 @@ func (w *FileWriter) Rotate() error {
 		return nil
 	}
 
+	// 将文件以pattern形式改名，本周期内已按大小切分过的沿用序号
+	filePath := fmt.Sprintf(w.pathFmt, old_variables...)
+	if next := w.nextIndexPath(filePath); w.backupExists(filePath) || next != indexPath(filePath, 1) {
+		filePath = next
+	}
+	return w.rotateTo(filePath)
+}
+
+// 文件超过maxSize时，以当前周期的pattern加序号改名
+func (w *FileWriter) rotateBySize() error {
+	filePath := w.filename
+	if len(w.actions) > 0 {
+		filePath = fmt.Sprintf(w.pathFmt, w.variables...)
+	} else if w.pathFmt != "" {
+		filePath = w.pathFmt
+	}
+	return w.rotateTo(w.nextIndexPath(filePath))
+}
+
+func (w *FileWriter) rotateTo(filePath string) error {
 	if w.fileBufWriter != nil {
 		if err := w.fileBufWriter.Flush(); err != nil {
 			return err
@@ -148,9 +251,6 @@ func (w *FileWriter) Rotate() error {
 	}
 
 	if w.file != nil {
-		// 将文件以pattern形式改名并关闭
-		filePath := fmt.Sprintf(w.pathFmt, old_variables...)
-
 		if err := os.Rename(w.filename, filePath); err != nil {
 			return err
 		}
@@ -160,7 +260,134 @@ func (w *FileWriter) Rotate() error {
 		}
 	}
 
-	return w.CreateLogFile()
+	if err := w.CreateLogFile(); err != nil {
+		return err
+	}
+	w.noticeOnly = true
+	go w.processBackup(filePath)
+	return nil
+}
+
+// 后台压缩刚切分出的文件，然后执行保留策略
+func (w *FileWriter) processBackup(filePath string) {
+	w.backupMutex.Lock()
+	defer w.backupMutex.Unlock()
+
+	// 文件可能已被之前的保留策略删除
+	if w.compress != "" {
+		if dst, err := compressFile(filePath, w.compress); err == nil {
+			w.notice("compress log backup", String("src", filePath), String("dst", dst))
+		} else if !os.IsNotExist(err) {
+			stderrLog.Println(err)
+		}
+	}
+	w.cleanBackups()
+}
+
+type backupFile struct {
+	path string
+	info os.FileInfo
+}
+
+// 按保留策略删除旧的备份文件，压缩与未压缩的备份一并计算
+func (w *FileWriter) cleanBackups() {
+	if w.backupGlob == "" || (w.maxBackups <= 0 && w.maxAge <= 0 && w.maxTotalSize <= 0) {
+		return
+	}
+
+	matches, err := filepath.Glob(w.backupGlob)
+	if err != nil {
+		stderrLog.Println(err)
+		return
+	}
+	backups := make([]backupFile, 0, len(matches))
+	for _, m := range matches {
+		if filepath.Clean(m) == filepath.Clean(w.filename) || !w.backupRegexp.MatchString(m) {
+			continue
+		}
+		info, err := os.Stat(m)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		backups = append(backups, backupFile{path: m, info: info})
+	}
+	// 新的在前
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].info.ModTime().After(backups[j].info.ModTime())
+	})
+
+	var total int64
+	now := time.Now()
+	for i, b := range backups {
+		total += b.info.Size()
+		reason := ""
+		if w.maxBackups > 0 && i >= w.maxBackups {
+			reason = "max_backups=" + strconv.Itoa(w.maxBackups)
+		} else if w.maxAge > 0 && now.Sub(b.info.ModTime()) > w.maxAge {
+			reason = "max_age=" + w.maxAge.String()
+		} else if w.maxTotalSize > 0 && total > w.maxTotalSize {
+			reason = "max_total_size=" + strconv.FormatInt(w.maxTotalSize, 10)
+		}
+		if reason == "" {
+			continue
+		}
+		if err := os.Remove(b.path); err != nil {
+			stderrLog.Println(err)
+			continue
+		}
+		w.notice("remove log backup", String("path", b.path), String("reason", reason))
+	}
+}
+
+// 通过注册的Logger输出备份处理记录，未注册时输出到stderr
+// 在后台goroutine中调用，不会在Write中执行
+func (w *FileWriter) notice(msg string, fields ...Field) {
+	if w.logger == nil {
+		stderrLog.Println("[INFO] " + msg + " " + (&Record{fields: fields}).body())
+		return
+	}
+	w.logger.Log(INFO, msg, append([]Field{String(FieldDLTag, DLTagLogBackup)}, fields...)...)
+}
+
+func isBackupNotice(r *Record) bool {
+	f, ok := r.Lookup(FieldDLTag)
+	return ok && f.Type == StringType && f.Value.(string) == DLTagLogBackup
+}
+
+// 注册到Logger时设置
+func (w *FileWriter) setLogger(l *Logger) {
+	w.logger = l
+}
+
+// 取已有序号的最大值加一，避免清理后序号被复用
+func (w *FileWriter) nextIndexPath(filePath string) string {
+	// Glob返回的路径没有./前缀
+	filePath = filepath.Clean(filePath)
+	max := 0
+	matches, _ := filepath.Glob(filePath + ".*")
+	for _, m := range matches {
+		suffix := strings.TrimPrefix(m, filePath+".")
+		if i := strings.IndexByte(suffix, '.'); i >= 0 {
+			suffix = suffix[:i]
+		}
+		if i, err := strconv.Atoi(suffix); err == nil && i > max {
+			max = i
+		}
+	}
+	return indexPath(filePath, max+1)
+}
+
+func (w *FileWriter) backupExists(filePath string) bool {
+	for _, ext := range []string{"", gzipExt, zstdExt} {
+		if _, err := os.Stat(filePath + ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func indexPath(filePath string, i int) string {
+	return filePath + "." + strconv.Itoa(i)
 }
 
 func (w *FileWriter) Flush() error {
@@ -199,6 +426,23 @@ func convertPatternToFmt(pattern []byte) string {
 	return string(pattern)
 }
 
+func convertPatternToGlob(pattern []byte) string {
+	for _, v := range []string{"%Y", "%M", "%D", "%H", "%m"} {
+		pattern = bytes.Replace(pattern, []byte(v), []byte("*"), -1)
+	}
+	return string(pattern)
+}
+
+// 匹配pattern生成的备份文件，包括按大小切分的序号
+func convertPatternToRegexp(pattern string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, "%Y", `\d{4}`, -1)
+	for _, v := range []string{"%M", "%D", "%H", "%m"} {
+		expr = strings.Replace(expr, v, `\d{2}`, -1)
+	}
+	return regexp.MustCompile("^" + expr + `(\.\d+)?(` + regexp.QuoteMeta(gzipExt) + `|` + regexp.QuoteMeta(zstdExt) + `)?$`)
+}
+
 func init() {
 	pathVariableTable = make(map[byte]func(*time.Time) int, 5)
 	pathVariableTable['Y'] = getYear
@@ -0,0 +1,182 @@
+package log_test
+
+import (
+	"bufio"
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 在临时目录中运行，日志路径使用配置中常见的./前缀
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	old, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(old) })
+}
+
+func newFileLogger(t *testing.T, w *log.FileWriter) (*log.Logger, *logtest.Recorder) {
+	t.Helper()
+	w.SetLogLevelFloor(log.TRACE)
+	w.SetLogLevelCeil(log.FATAL)
+	l, rec := logtest.NewLogger()
+	l.Register(w)
+	return l, rec
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []string
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines
+}
+
+func TestFileWriterRotateBySize(t *testing.T) {
+	chdirTemp(t)
+	w := log.NewFileWriter()
+	w.SetFileName("./r.log")
+	w.SetMaxSize(200)
+	l, rec := newFileLogger(t, w)
+	for i := 0; i < 30; i++ {
+		l.Info("line %02d", i)
+	}
+	l.Close()
+
+	// 每次切分使用新的序号，不覆盖已有的备份，序号越大越新
+	backups, _ := filepath.Glob("r.log.*")
+	if len(backups) < 2 {
+		t.Fatalf("backups = %v, want one per rotation", backups)
+	}
+	var lines []string
+	for i := 1; i <= len(backups); i++ {
+		path := "r.log." + strconv.Itoa(i)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("backup %s missing: %v", path, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s has %d bytes, max 200", path, info.Size())
+		}
+		lines = append(lines, readLines(t, path)...)
+	}
+	lines = append(lines, readLines(t, "r.log")...)
+
+	entries := rec.Entries()
+	if len(lines) != len(entries) {
+		t.Fatalf("files hold %d lines, want %d", len(lines), len(entries))
+	}
+	for i, e := range entries {
+		if !strings.HasSuffix(lines[i], " "+e.Message) {
+			t.Errorf("line %d = %q, want message %q", i, lines[i], e.Message)
+		}
+	}
+}
+
+// 后台处理备份结束后备份文件个数不再变化
+func waitBackups(t *testing.T, pattern string, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		backups, _ := filepath.Glob(pattern)
+		if len(backups) <= n || time.Now().After(deadline) {
+			time.Sleep(50 * time.Millisecond)
+			backups, _ = filepath.Glob(pattern)
+			return backups
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newRetentionWriter() *log.FileWriter {
+	w := log.NewFileWriter()
+	w.SetFileName("./r.log")
+	w.SetPathPattern("./r.log")
+	w.SetMaxSize(200)
+	return w
+}
+
+func TestFileWriterMaxBackups(t *testing.T) {
+	chdirTemp(t)
+	// 不是pattern生成的备份，不受保留策略影响
+	if err := os.WriteFile("r.log.old", []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := newRetentionWriter()
+	w.SetMaxBackups(2)
+	l, rec := newFileLogger(t, w)
+	for i := 0; i < 30; i++ {
+		l.Info("line %02d", i)
+	}
+	backups := waitBackups(t, "r.log.*", 3)
+	l.Close()
+
+	if len(backups) != 3 {
+		t.Fatalf("backups = %v, want 2 backups and r.log.old", backups)
+	}
+	if _, err := os.Stat("r.log.old"); err != nil {
+		t.Errorf("unrelated file removed: %v", err)
+	}
+	if _, err := os.Stat("r.log.1"); err == nil {
+		t.Error("oldest backup r.log.1 was kept")
+	}
+	rec.Expect(t, logtest.DLTag(log.DLTagLogBackup), logtest.Message("remove log backup"),
+		logtest.Field("path", "r.log.1"), logtest.Field("reason", "max_backups=2"))
+
+	// 备份处理记录计入大小，超过max_size的只能是仅含备份处理记录的文件
+	for _, path := range append(backups, "r.log") {
+		info, err := os.Stat(path)
+		if err != nil || info.Size() <= 200 {
+			continue
+		}
+		for _, line := range readLines(t, path) {
+			if !strings.Contains(line, log.DLTagLogBackup) {
+				t.Errorf("%s has %d bytes, max 200", path, info.Size())
+				break
+			}
+		}
+	}
+}
+
+func TestFileWriterMaxAge(t *testing.T) {
+	chdirTemp(t)
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.WriteFile("r.log.1", []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes("r.log.1", old, old)
+
+	w := newRetentionWriter()
+	w.SetMaxAge(24 * time.Hour)
+	l, rec := newFileLogger(t, w)
+	// 第4行触发一次切分
+	for i := 0; i < 4; i++ {
+		l.Info("line %02d", i)
+	}
+	backups := waitBackups(t, "r.log.*", 1)
+	l.Close()
+
+	if len(backups) != 1 || backups[0] != "r.log.2" {
+		t.Fatalf("backups = %v, want only r.log.2", backups)
+	}
+	rec.Expect(t, logtest.DLTag(log.DLTagLogBackup), logtest.Message("remove log backup"),
+		logtest.Field("path", "r.log.1"), logtest.Field("reason", "max_age=24h0m0s"))
+}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type Formatter interface {
+	Format(*Record) string
+}
+
+// 默认文本格式: [LEVEL][time][code] info
+type TextFormatter struct {
+}
+
+func (f *TextFormatter) Format(r *Record) string {
+	return r.String()
+}
+
+// 带颜色的文本格式，用于控制台输出
+type ColorFormatter struct {
+}
+
+func (f *ColorFormatter) Format(r *Record) string {
+	return ((*colorRecord)(r)).String()
+}
+
+// JSON格式，每条记录一行
+type JSONFormatter struct {
+}
+
+// 与字段重名时加 fields. 前缀
+var jsonReservedKeys = map[string]struct{}{"level": {}, "time": {}, "caller": {}, "func": {}, "message": {}}
+
+func (f *JSONFormatter) Format(r *Record) string {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	writeJSONKV(buf, "level", LEVEL_FLAGS[r.level])
+	buf.WriteByte(',')
+	writeJSONKV(buf, "time", r.time)
+	buf.WriteByte(',')
+	writeJSONKV(buf, "caller", r.code)
+	if r.fn != "" {
+		buf.WriteByte(',')
+		writeJSONKV(buf, "func", r.fn)
+	}
+	buf.WriteByte(',')
+	writeJSONKV(buf, "message", r.info)
+	for _, f := range r.fields {
+		buf.WriteByte(',')
+		key := f.Key
+		if _, ok := jsonReservedKeys[key]; ok {
+			key = "fields." + key
+		}
+		writeJSONKV(buf, key, f.JSONValue())
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func writeJSONKV(buf *bytes.Buffer, key string, value interface{}) {
+	writeJSONValue(buf, key)
+	buf.WriteByte(':')
+	writeJSONValue(buf, value)
+}
+
+func writeJSONValue(buf *bytes.Buffer, value interface{}) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		// 无法编码的值退化为文本
+		if err = enc.Encode(fmt.Sprintf("%+v", value)); err != nil {
+			buf.WriteString(`"!ERROR:` + err.Error() + `"`)
+			return
+		}
+	}
+	// Encode 会追加换行符
+	buf.Truncate(buf.Len() - 1)
+}
+
+// 根据配置名称创建Formatter，空字符串表示默认文本格式
+func NewFormatter(name string) (Formatter, error) {
+	switch name {
+	case "", "text":
+		return &TextFormatter{}, nil
+
+	case "color":
+		return &ColorFormatter{}, nil
+
+	case "json":
+		return &JSONFormatter{}, nil
+	}
+	return nil, errors.New("Invalid log format (" + name + ")")
+}
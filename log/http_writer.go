@@ -0,0 +1,370 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HTTPModeElasticsearch = "elasticsearch"
+	HTTPModeLoki          = "loki"
+	HTTPModeOTLP          = "otlp"
+)
+
+const (
+	http_batch_size_default     = 500
+	http_flush_interval_default = time.Second
+	http_max_retries_default    = 3
+	http_max_in_flight_default  = 2
+	http_timeout_default        = 10 * time.Second
+	http_retry_backoff          = 500 * time.Millisecond
+)
+
+type httpEntry struct {
+	t      time.Time
+	labels string
+	line   string
+}
+
+// 批量发送到Elasticsearch _bulk、Loki push 或 OTLP/HTTP logs 接口，按条数或时间触发发送
+type HTTPWriter struct {
+	mode          string
+	url           string
+	index         string
+	labels        map[string]string
+	resource      map[string]string
+	otlpEncoding  string
+	header        http.Header
+	formatter     Formatter
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	gzip          bool
+	client        *http.Client
+	entries       []httpEntry
+	firstAt       time.Time
+	inFlight      chan struct{}
+	wg            sync.WaitGroup
+}
+
+func NewHTTPWriter() *HTTPWriter {
+	return &HTTPWriter{
+		labels:        map[string]string{},
+		resource:      map[string]string{},
+		otlpEncoding:  OTLPEncodingJSON,
+		header:        http.Header{},
+		batchSize:     http_batch_size_default,
+		flushInterval: http_flush_interval_default,
+		maxRetries:    http_max_retries_default,
+		inFlight:      make(chan struct{}, http_max_in_flight_default),
+		client:        &http.Client{Timeout: http_timeout_default},
+	}
+}
+
+// mode: elasticsearch、loki、otlp；url为 _bulk、/loki/api/v1/push 或 /v1/logs 的完整地址
+func (w *HTTPWriter) SetEndpoint(mode, url string) {
+	w.mode = mode
+	w.url = url
+}
+
+// Elasticsearch的索引名，支持与文件切分相同的日期变量%Y、%M、%D、%H，如 logs-%Y.%M.%D，其余字符原样保留
+func (w *HTTPWriter) SetIndex(index string) {
+	w.index = index
+}
+
+func (w *HTTPWriter) indexName(t *time.Time) string {
+	if strings.IndexByte(w.index, '%') < 0 {
+		return w.index
+	}
+	buf := make([]byte, 0, len(w.index)+8)
+	for i := 0; i < len(w.index); i++ {
+		c := w.index[i]
+		// 不支持%m，避免按分钟生成索引
+		if c == '%' && i+1 < len(w.index) && strings.IndexByte("YMDH", w.index[i+1]) >= 0 {
+			if act, ok := pathVariableTable[w.index[i+1]]; ok {
+				v := act(t)
+				if w.index[i+1] != 'Y' && v < 10 {
+					buf = append(buf, '0')
+				}
+				buf = strconv.AppendInt(buf, int64(v), 10)
+				i++
+				continue
+			}
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
+
+// Loki的固定label，如env
+func (w *HTTPWriter) SetLabel(key, value string) {
+	w.labels[key] = value
+}
+
+// OTLP的resource属性，如service.name
+func (w *HTTPWriter) SetResource(key, value string) {
+	w.resource[key] = value
+}
+
+// OTLP请求体编码：json、protobuf
+func (w *HTTPWriter) SetOTLPEncoding(encoding string) {
+	if encoding != "" {
+		w.otlpEncoding = encoding
+	}
+}
+
+func (w *HTTPWriter) SetHeader(key, value string) {
+	w.header.Set(key, value)
+}
+
+// Loki每行的格式，默认文本格式；Elasticsearch固定为JSON
+func (w *HTTPWriter) SetFormatter(f Formatter) {
+	w.formatter = f
+}
+
+func (w *HTTPWriter) SetBatch(size int, interval time.Duration) {
+	if size > 0 {
+		w.batchSize = size
+	}
+	if interval > 0 {
+		w.flushInterval = interval
+	}
+}
+
+func (w *HTTPWriter) SetMaxRetries(n int) {
+	if n >= 0 {
+		w.maxRetries = n
+	}
+}
+
+func (w *HTTPWriter) SetGzip(on bool) {
+	w.gzip = on
+}
+
+// 同时进行中的请求数上限，达到上限后Write阻塞
+func (w *HTTPWriter) SetMaxInFlight(n int) {
+	if n > 0 {
+		w.inFlight = make(chan struct{}, n)
+	}
+}
+
+func (w *HTTPWriter) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		w.client.Timeout = timeout
+	}
+}
+
+func (w *HTTPWriter) Init() error {
+	switch w.mode {
+	case HTTPModeElasticsearch:
+		if w.index == "" {
+			return errors.New("elasticsearch index is empty")
+		}
+	case HTTPModeLoki:
+	case HTTPModeOTLP:
+		if w.otlpEncoding != OTLPEncodingJSON && w.otlpEncoding != OTLPEncodingProtobuf {
+			return errors.New("Invalid otlp encoding (" + w.otlpEncoding + ")")
+		}
+	default:
+		return errors.New("Invalid http writer mode (" + w.mode + ")")
+	}
+	if w.url == "" {
+		return errors.New("http writer url is empty")
+	}
+	return nil
+}
+
+func (w *HTTPWriter) Write(r *Record) error {
+	if len(w.entries) == 0 {
+		w.firstAt = time.Now()
+	}
+	w.entries = append(w.entries, w.newEntry(r))
+	if len(w.entries) >= w.batchSize {
+		w.send()
+	}
+	return nil
+}
+
+// 最早的记录超过发送间隔时发送
+func (w *HTTPWriter) Flush() error {
+	if len(w.entries) > 0 && time.Since(w.firstAt) >= w.flushInterval {
+		w.send()
+	}
+	return nil
+}
+
+// 发送剩余记录并等待所有请求结束
+func (w *HTTPWriter) Close() error {
+	if len(w.entries) > 0 {
+		w.send()
+	}
+	w.wg.Wait()
+	return nil
+}
+
+// Record写完后会被复用，需要先格式化
+func (w *HTTPWriter) newEntry(r *Record) httpEntry {
+	e := httpEntry{t: r.t}
+	if w.mode == HTTPModeOTLP {
+		e.line = encodeOTLPRecord(r, w.otlpEncoding)
+		return e
+	}
+	if w.mode == HTTPModeElasticsearch {
+		doc := (&JSONFormatter{}).Format(r)
+		ts, _ := json.Marshal(r.t.Format(time.RFC3339Nano))
+		e.line = `{"@timestamp":` + string(ts) + "," + doc[1:]
+		return e
+	}
+
+	if w.formatter != nil {
+		e.line = w.formatter.Format(r)
+	} else {
+		e.line = r.String()
+	}
+	e.line = strings.TrimRight(e.line, "\n")
+	labels := map[string]string{"level": strings.ToLower(LEVEL_FLAGS[r.level])}
+	if f, ok := r.Lookup(FieldDLTag); ok && f.Text() != "" {
+		labels["dltag"] = f.Text()
+	}
+	for k, v := range w.labels {
+		labels[k] = v
+	}
+	b, _ := json.Marshal(labels)
+	e.labels = string(b)
+	return e
+}
+
+func (w *HTTPWriter) send() {
+	body := w.encode(w.entries)
+	w.entries = nil
+	w.inFlight <- struct{}{}
+	w.wg.Add(1)
+	go func() {
+		defer func() {
+			<-w.inFlight
+			w.wg.Done()
+		}()
+		if err := w.post(body); err != nil {
+			stderrLog.Println(err)
+		}
+	}()
+}
+
+func (w *HTTPWriter) encode(entries []httpEntry) []byte {
+	if w.mode == HTTPModeOTLP {
+		records := make([]string, 0, len(entries))
+		for _, e := range entries {
+			records = append(records, e.line)
+		}
+		return encodeOTLPRequest(w.resource, records, w.otlpEncoding)
+	}
+
+	buf := &bytes.Buffer{}
+	if w.mode == HTTPModeElasticsearch {
+		for _, e := range entries {
+			index, _ := json.Marshal(w.indexName(&e.t))
+			buf.WriteString(`{"index":{"_index":` + string(index) + "}}\n")
+			buf.WriteString(e.line)
+		}
+		return buf.Bytes()
+	}
+
+	// 相同label的记录合并为一个stream
+	streams := map[string][][2]string{}
+	order := []string{}
+	for _, e := range entries {
+		if _, ok := streams[e.labels]; !ok {
+			order = append(order, e.labels)
+		}
+		streams[e.labels] = append(streams[e.labels], [2]string{strconv.FormatInt(e.t.UnixNano(), 10), e.line})
+	}
+	buf.WriteString(`{"streams":[`)
+	for i, labels := range order {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		values, _ := json.Marshal(streams[labels])
+		buf.WriteString(`{"stream":` + labels + `,"values":` + string(values) + "}")
+	}
+	buf.WriteString("]}")
+	return buf.Bytes()
+}
+
+func (w *HTTPWriter) post(body []byte) (err error) {
+	if w.gzip {
+		buf := &bytes.Buffer{}
+		zw := gzip.NewWriter(buf)
+		zw.Write(body)
+		zw.Close()
+		body = buf.Bytes()
+	}
+	var retry bool
+	for i := 0; i <= w.maxRetries; i++ {
+		if i > 0 {
+			time.Sleep(http_retry_backoff << uint(i-1))
+		}
+		if retry, err = w.postOnce(body); err == nil || !retry {
+			return
+		}
+	}
+	return
+}
+
+// 网络错误、429和5xx可以重试
+func (w *HTTPWriter) postOnce(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range w.header {
+		req.Header[k] = v
+	}
+	switch {
+	case w.mode == HTTPModeElasticsearch:
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	case w.mode == HTTPModeOTLP && w.otlpEncoding == OTLPEncodingProtobuf:
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	default:
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if w.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return true, errors.New("http writer: " + resp.Status + " " + httpErrorBody(data))
+	}
+	if resp.StatusCode >= 300 {
+		return false, errors.New("http writer: " + resp.Status + " " + httpErrorBody(data))
+	}
+	if w.mode == HTTPModeElasticsearch {
+		// _bulk 部分失败时仍返回200
+		var result struct {
+			Errors bool `json:"errors"`
+		}
+		if json.Unmarshal(data, &result) == nil && result.Errors {
+			return false, errors.New("http writer: elasticsearch bulk has errors " + httpErrorBody(data))
+		}
+	}
+	return false, nil
+}
+
+func httpErrorBody(data []byte) string {
+	if len(data) > 1024 {
+		return string(data[:1024]) + "..."
+	}
+	return string(data)
+}
@@ -0,0 +1,164 @@
+package log_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type httpRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// 记录收到的请求，gzip请求体解压后保存
+func newHTTPCollector(t *testing.T, response string) (string, chan httpRequest) {
+	t.Helper()
+	requests := make(chan httpRequest, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err == nil && req.Header.Get("Content-Encoding") == "gzip" {
+			var zr *gzip.Reader
+			if zr, err = gzip.NewReader(bytes.NewReader(body)); err == nil {
+				body, err = ioutil.ReadAll(zr)
+			}
+		}
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests <- httpRequest{header: req.Header, body: body}
+		rw.Write([]byte(response))
+	}))
+	t.Cleanup(s.Close)
+	return s.URL, requests
+}
+
+// 所有记录在Close时作为一个批次发送
+func newHTTPLogger(w *log.HTTPWriter) (*log.Logger, *logtest.Recorder) {
+	l, rec := logtest.NewLogger()
+	w.SetBatch(100, time.Hour)
+	w.SetMaxRetries(0)
+	l.Register(w)
+	return l, rec
+}
+
+func receiveRequest(t *testing.T, requests chan httpRequest) httpRequest {
+	t.Helper()
+	select {
+	case req := <-requests:
+		return req
+	default:
+		t.Fatal("no request received")
+	}
+	return httpRequest{}
+}
+
+func TestHTTPWriterElasticsearchBulk(t *testing.T) {
+	url, requests := newHTTPCollector(t, `{"errors":false,"items":[]}`)
+	w := log.NewHTTPWriter()
+	w.SetEndpoint(log.HTTPModeElasticsearch, url+"/_bulk")
+	w.SetIndex("logs-%Y.%M.%D-%m")
+	w.SetGzip(true)
+	l, rec := newHTTPLogger(w)
+	l.Log(log.INFO, "request in", log.String(log.FieldDLTag, "_com_request_in"), log.Int("status", 200))
+	l.Log(log.ERROR, "query failed", log.String(log.FieldDLTag, "_com_mysql_failure"))
+	l.Close()
+
+	req := receiveRequest(t, requests)
+	if ct := req.header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(req.body), "\n"), "\n")
+	entries := rec.Entries()
+	if len(lines) != 2*len(entries) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), 2*len(entries), req.body)
+	}
+	for i, e := range entries {
+		var action struct {
+			Index struct {
+				Index string `json:"_index"`
+			} `json:"index"`
+		}
+		if err := json.Unmarshal([]byte(lines[2*i]), &action); err != nil {
+			t.Fatalf("action line %q: %v", lines[2*i], err)
+		}
+		// %m原样保留
+		if want := e.Time.Format("logs-2006.01.02") + "-%m"; action.Index.Index != want {
+			t.Errorf("_index = %q, want %q", action.Index.Index, want)
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[2*i+1]), &doc); err != nil {
+			t.Fatalf("document line %q: %v", lines[2*i+1], err)
+		}
+		ts, _ := doc["@timestamp"].(string)
+		if parsed, err := time.Parse(time.RFC3339Nano, ts); err != nil || !parsed.Equal(e.Time) {
+			t.Errorf("@timestamp = %q, want %v", ts, e.Time)
+		}
+		if doc["message"] != e.Message || doc["dltag"] != e.DLTag() || doc["caller"] != e.Code {
+			t.Errorf("document %v does not match record %s", doc, e)
+		}
+	}
+}
+
+func TestHTTPWriterLokiPush(t *testing.T) {
+	url, requests := newHTTPCollector(t, "")
+	w := log.NewHTTPWriter()
+	w.SetEndpoint(log.HTTPModeLoki, url+"/loki/api/v1/push")
+	w.SetLabel("env", "dev")
+	l, rec := newHTTPLogger(w)
+	l.Log(log.INFO, "request in", log.String(log.FieldDLTag, "_com_request_in"))
+	l.Log(log.ERROR, "query failed", log.String(log.FieldDLTag, "_com_mysql_failure"))
+	l.Log(log.INFO, "request out", log.String(log.FieldDLTag, "_com_request_in"))
+	l.Close()
+
+	req := receiveRequest(t, requests)
+	if ct := req.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(req.body, &push); err != nil {
+		t.Fatalf("%v: %s", err, req.body)
+	}
+
+	// 相同label的记录在同一个stream中，按首次出现的顺序
+	entries := rec.Entries()
+	groups := [][]logtest.Entry{{entries[0], entries[2]}, {entries[1]}}
+	if len(push.Streams) != len(groups) {
+		t.Fatalf("got %d streams, want %d: %s", len(push.Streams), len(groups), req.body)
+	}
+	for i, group := range groups {
+		s := push.Streams[i]
+		want := map[string]string{"level": strings.ToLower(log.LEVEL_FLAGS[group[0].Level]), "dltag": group[0].DLTag(), "env": "dev"}
+		if fmt.Sprint(s.Stream) != fmt.Sprint(want) {
+			t.Errorf("stream labels = %v, want %v", s.Stream, want)
+		}
+		if len(s.Values) != len(group) {
+			t.Fatalf("stream %v has %d values, want %d", s.Stream, len(s.Values), len(group))
+		}
+		for j, e := range group {
+			if s.Values[j][0] != strconv.FormatInt(e.Time.UnixNano(), 10) {
+				t.Errorf("value timestamp = %s, want %d", s.Values[j][0], e.Time.UnixNano())
+			}
+			if strings.HasSuffix(s.Values[j][1], "\n") || !strings.Contains(s.Values[j][1], e.Message) {
+				t.Errorf("value line = %q, want message %q", s.Values[j][1], e.Message)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package log
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// 解析配置中的日志级别名称
+func ParseLevel(name string) (int, error) {
+	switch strings.ToLower(name) {
+	case "trace":
+		return TRACE, nil
+
+	case "debug":
+		return DEBUG, nil
+
+	case "info":
+		return INFO, nil
+
+	case "warn", "warning":
+		return WARNING, nil
+
+	case "error":
+		return ERROR, nil
+
+	case "fatal":
+		return FATAL, nil
+	}
+	return 0, errors.New("Invalid log level")
+}
+
+// 运行时修改日志级别，并输出一条不受级别限制的变更日志
+func (l *Logger) ChangeLevel(lvl int, source string) {
+	if lvl < TRACE || lvl > FATAL {
+		return
+	}
+	old := int(atomic.SwapInt32(&l.level, int32(lvl)))
+	l.send(l.newRecord(WARNING, "", "log level changed from "+LEVEL_FLAGS[old]+" to "+LEVEL_FLAGS[lvl], []Field{
+		String("logger", l.name),
+		String("source", source),
+	}))
+}
+
+// 按step调整级别，超出TRACE..FATAL时循环
+func cycleLevel(lvl int, step int) int {
+	n := len(LEVEL_FLAGS)
+	return ((lvl+step)%n + n) % n
+}
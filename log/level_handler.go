@@ -0,0 +1,78 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type levelBody struct {
+	Logger string `json:"logger"`
+	Level  string `json:"level"`
+}
+
+// 查看和修改日志级别
+// GET /?logger=name        不传logger时返回全部Logger的级别
+// PUT /?logger=name&level=info 或 body {"level":"info"}，logger默认为default
+func LevelHandler() http.Handler {
+	return http.HandlerFunc(serveLevel)
+}
+
+func serveLevel(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("logger")
+	switch req.Method {
+	case http.MethodGet:
+		if name == "" {
+			levels := make([]levelBody, 0)
+			for _, n := range Names() {
+				if l, ok := lookup(n); ok {
+					levels = append(levels, levelBody{Logger: n, Level: LEVEL_FLAGS[l.Level()]})
+				}
+			}
+			writeLevelJSON(w, http.StatusOK, levels)
+			return
+		}
+		l, ok := lookup(name)
+		if !ok {
+			http.Error(w, "logger not found", http.StatusNotFound)
+			return
+		}
+		writeLevelJSON(w, http.StatusOK, levelBody{Logger: name, Level: LEVEL_FLAGS[l.Level()]})
+
+	case http.MethodPut:
+		body := levelBody{Level: req.URL.Query().Get("level")}
+		if body.Level == "" {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if name == "" {
+			name = body.Logger
+		}
+		if name == "" {
+			name = DefaultLoggerName
+		}
+		lvl, err := ParseLevel(body.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		l, ok := lookup(name)
+		if !ok {
+			http.Error(w, "logger not found", http.StatusNotFound)
+			return
+		}
+		l.ChangeLevel(lvl, "http "+req.RemoteAddr)
+		writeLevelJSON(w, http.StatusOK, levelBody{Logger: name, Level: LEVEL_FLAGS[l.Level()]})
+
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeLevelJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+
+package log
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var levelSignalOnce sync.Once
+
+// 监听信号修改所有Logger的级别：SIGUSR1降低一级(输出更多)，SIGUSR2升高一级，超出范围后循环
+func WatchLevelSignal() {
+	levelSignalOnce.Do(func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+		go func() {
+			for sig := range c {
+				step := -1
+				if sig == syscall.SIGUSR2 {
+					step = 1
+				}
+				for _, name := range Names() {
+					if l, ok := lookup(name); ok {
+						l.ChangeLevel(cycleLevel(l.Level(), step), "signal "+sig.String())
+					}
+				}
+			}
+		}()
+	})
+}
@@ -0,0 +1,5 @@
+package log
+
+// windows下没有SIGUSR1/SIGUSR2
+func WatchLevelSignal() {
+}
@@ -2,11 +2,12 @@ package log
 
 import (
 	"fmt"
-	"log"
 	"path"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,14 +27,87 @@ const (
 const tunnel_size_default = 1024
 
 type Record struct {
-	time  string
-	code  string
-	info  string
-	level int
+	t      time.Time
+	time   string
+	code   string
+	fn     string
+	info   string
+	level  int
+	fields []Field
+	refs   int32
 }
 
 func (r *Record) String() string {
-	return fmt.Sprintf("[%s][%s][%s] %s\n", LEVEL_FLAGS[r.level], r.time, r.code, r.info)
+	return fmt.Sprintf("[%s][%s][%s] %s\n", LEVEL_FLAGS[r.level], r.time, r.caller(), r.body())
+}
+
+// 文本格式的调用位置，开启函数名时为 file:line func
+func (r *Record) caller() string {
+	if r.fn == "" {
+		return r.code
+	}
+	return r.code + " " + r.fn
+}
+
+// 文本格式的日志内容: dltag||info||k=v||k=v
+func (r *Record) body() string {
+	if len(r.fields) == 0 {
+		return r.info
+	}
+	parts := make([]string, 0, len(r.fields)+1)
+	if f, ok := r.Lookup(FieldDLTag); ok {
+		parts = append(parts, f.Text())
+	}
+	if r.info != "" {
+		parts = append(parts, r.info)
+	}
+	for _, f := range r.fields {
+		if f.Key == FieldDLTag {
+			continue
+		}
+		parts = append(parts, f.Key+"="+f.Text())
+	}
+	body := strconv.Quote(strings.Join(parts, "||"))
+	return body[1 : len(body)-1]
+}
+
+func (r *Record) Level() int {
+	return r.level
+}
+
+func (r *Record) Time() string {
+	return r.time
+}
+
+// 记录产生的时间
+func (r *Record) Timestamp() time.Time {
+	return r.t
+}
+
+func (r *Record) Code() string {
+	return r.code
+}
+
+// 调用方函数名，需要Logger开启SetCallerFunc
+func (r *Record) Func() string {
+	return r.fn
+}
+
+func (r *Record) Info() string {
+	return r.info
+}
+
+func (r *Record) Fields() []Field {
+	return r.fields
+}
+
+func (r *Record) Lookup(key string) (Field, bool) {
+	for _, f := range r.fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
 }
 
 type Writer interface {
@@ -50,93 +124,206 @@ type Flusher interface {
 	Flush() error
 }
 
+// Logger关闭时，Writer剩余记录写完后调用
+type Closer interface {
+	Close() error
+}
+
 type Logger struct {
-	writers      []Writer
-	tunnel       chan *Record
-	level        int
-	lastTime     int64
-	lastTimeStr  string
-	c            chan bool
-	layout       string
-	recordPool   *sync.Pool
-	loadLocation *time.Location
+	*logCore
+	callerSkip int
+	// With绑定的字段，输出在调用时传入的字段之前
+	fields []Field
+}
+
+// Logger之间共享的状态，AddCallerSkip返回的Logger与原Logger共用
+type logCore struct {
+	name            string
+	dropped         [len(LEVEL_FLAGS)]uint64
+	droppedReported [len(LEVEL_FLAGS)]uint64
+	workers         []*writerWorker
+	workersMutex    sync.RWMutex
+	queueSize       int
+	tunnel          chan *Record
+	tunnelMutex     sync.RWMutex
+	tunnelSwitch    chan chan *Record
+	overflowPolicy  int
+	blockTimeout    time.Duration
+	closed          bool
+	level           int32
+	timeFormat      atomic.Value
+	timeCache       atomic.Value
+	timeMutex       sync.Mutex
+	fieldOrder      atomic.Value
+	redactor        atomic.Value
+	c               chan bool
+	recordPool      *sync.Pool
+	callerFunc      int32
+	// 同步模式下在调用方goroutine中依次写入
+	syncMode  bool
+	syncMutex sync.Mutex
 }
 
+// 创建独立的Logger，需要按名称共享时使用Get
 func NewLogger() *Logger {
-	if logger_default != nil && takeup == false {
-		takeup = true //默认启动标志
-		return logger_default
-	}
-	l := new(Logger)
-	l.writers = []Writer{}
+	l := &Logger{logCore: &logCore{}}
+	l.workers = []*writerWorker{}
+	l.queueSize = writer_queue_size_default
 	l.tunnel = make(chan *Record, tunnel_size_default)
+	l.tunnelSwitch = make(chan chan *Record, 8)
 	l.c = make(chan bool, 2)
 	l.level = DEBUG
-	l.layout = "2006/01/02 15:04:05"
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		loc = time.Local
+	}
+	l.timeFormat.Store(newTimeFormat("2006/01/02 15:04:05", loc))
+	l.fieldOrder.Store(newFieldOrder(nil, false))
+	l.redactor.Store((*Redactor)(nil))
 	l.recordPool = &sync.Pool{New: func() interface{} {
 		return &Record{}
 	}}
-	l.loadLocation, _ = time.LoadLocation("Asia/Shanghai")
 	go boostrapLogWriter(l)
 
 	return l
 }
 
+// 同步写入的Logger，日志函数返回时已写入各Writer，用于测试
+func NewSyncLogger() *Logger {
+	l := NewLogger()
+	l.syncMode = true
+	return l
+}
+
 func (l *Logger) Register(w Writer) {
 	if err := w.Init(); err != nil {
 		panic(err)
 	}
-	l.writers = append(l.writers, w)
+	if lw, ok := w.(interface{ setLogger(*Logger) }); ok {
+		lw.setLogger(l)
+	}
+	l.workersMutex.Lock()
+	if l.syncMode {
+		l.workers = append(l.workers, newSyncWriterWorker(w, l.releaseRecord))
+	} else {
+		l.workers = append(l.workers, newWriterWorker(w, l.queueSize, l.releaseRecord, l.countDropped))
+	}
+	l.workersMutex.Unlock()
+}
+
+// 之后注册的Writer的队列长度
+func (l *Logger) SetWriterQueueSize(size int) {
+	if size > 0 {
+		l.queueSize = size
+	}
+}
+
+// 各Writer的队列统计
+func (l *Logger) Stats() []WriterStat {
+	l.workersMutex.RLock()
+	defer l.workersMutex.RUnlock()
+	stats := make([]WriterStat, 0, len(l.workers))
+	for _, ww := range l.workers {
+		stats = append(stats, ww.stat())
+	}
+	return stats
 }
 
 func (l *Logger) SetLevel(lvl int) {
-	l.level = lvl
+	atomic.StoreInt32(&l.level, int32(lvl))
 }
 
-func (l *Logger) SetLayout(layout string) {
-	l.layout = layout
+func (l *Logger) Level() int {
+	return int(atomic.LoadInt32(&l.level))
+}
+
+func (l *Logger) Name() string {
+	return l.name
 }
 
 func (l *Logger) Trace(fmt string, args ...interface{}) {
-	l.deliverRecordToWriter(TRACE, fmt, args...)
+	l.deliverRecordToWriter(0, TRACE, nil, fmt, args...)
 }
 
 func (l *Logger) Debug(fmt string, args ...interface{}) {
-	l.deliverRecordToWriter(DEBUG, fmt, args...)
+	l.deliverRecordToWriter(0, DEBUG, nil, fmt, args...)
 }
 
 func (l *Logger) Warn(fmt string, args ...interface{}) {
-	l.deliverRecordToWriter(WARNING, fmt, args...)
+	l.deliverRecordToWriter(0, WARNING, nil, fmt, args...)
 }
 
 func (l *Logger) Info(fmt string, args ...interface{}) {
-	l.deliverRecordToWriter(INFO, fmt, args...)
+	l.deliverRecordToWriter(0, INFO, nil, fmt, args...)
 }
 
 func (l *Logger) Error(fmt string, args ...interface{}) {
-	l.deliverRecordToWriter(ERROR, fmt, args...)
+	l.deliverRecordToWriter(0, ERROR, nil, fmt, args...)
 }
 
 func (l *Logger) Fatal(fmt string, args ...interface{}) {
-	l.deliverRecordToWriter(FATAL, fmt, args...)
+	l.deliverRecordToWriter(0, FATAL, nil, fmt, args...)
+}
+
+// 输出带结构化字段的日志
+func (l *Logger) Log(level int, msg string, fields ...Field) {
+	l.deliverRecordToWriter(0, level, fields, "", msg)
+}
+
+// 同Log，depth为在调用方基础上额外跳过的调用栈层数，用于封装函数
+func (l *Logger) LogDepth(depth int, level int, msg string, fields ...Field) {
+	l.deliverRecordToWriter(depth, level, fields, "", msg)
+}
+
+// 返回额外跳过n层调用栈的Logger，供封装层使用，与原Logger共用输出和配置
+func (l *Logger) AddCallerSkip(n int) *Logger {
+	c := *l
+	c.callerSkip += n
+	return &c
+}
+
+// 返回绑定字段的子Logger，之后的每条日志都带有这些字段，与原Logger共用输出和配置
+// 同名字段以调用时传入的为准
+func (l *Logger) With(fields ...Field) *Logger {
+	c := *l
+	if len(fields) > 0 {
+		c.fields = mergeFields(append([]Field(nil), l.fields...), fields)
+	}
+	return &c
+}
+
+// 是否在调用位置中输出函数名
+func (l *Logger) SetCallerFunc(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&l.callerFunc, v)
 }
 
 func (l *Logger) Close() {
+	l.tunnelMutex.Lock()
+	if l.closed {
+		l.tunnelMutex.Unlock()
+		return
+	}
+	l.closed = true
 	close(l.tunnel)
+	l.tunnelMutex.Unlock()
 	<-l.c
-	for _, w := range l.writers {
-		if f, ok := w.(Flusher); ok {
-			if err := f.Flush(); err != nil {
-				log.Println(err)
-			}
-		}
+}
+
+// 所有Writer都处理完后放回pool
+func (l *Logger) releaseRecord(r *Record) {
+	if atomic.AddInt32(&r.refs, -1) <= 0 {
+		l.recordPool.Put(r)
 	}
 }
 
-func (l *Logger) deliverRecordToWriter(level int, format string, args ...interface{}) {
-	var inf, code string
+func (l *Logger) deliverRecordToWriter(depth int, level int, fields []Field, format string, args ...interface{}) {
+	var inf, code, fn string
 
-	if level < l.level {
+	if level < l.Level() {
 		return
 	}
 
@@ -147,154 +334,187 @@ func (l *Logger) deliverRecordToWriter(level int, format string, args ...interfa
 	}
 
 	// source code, file and line num
-	_, file, line, ok := runtime.Caller(2)
+	pc, file, line, ok := runtime.Caller(2 + depth + l.callerSkip)
 	if ok {
 		code = path.Base(file) + ":" + strconv.Itoa(line)
+		if atomic.LoadInt32(&l.callerFunc) == 1 {
+			if f := runtime.FuncForPC(pc); f != nil {
+				fn = path.Base(f.Name())
+			}
+		}
 	}
 
-	// format time
-	now := time.Now()
-	if now.Unix() != l.lastTime {
-		l.lastTime = now.Unix()
-		l.lastTimeStr = now.In(l.loadLocation).UTC().String()
+	l.deliver(level, code, fn, inf, fields)
+}
+
+// 调用位置已确定的记录
+func (l *Logger) deliver(level int, code string, fn string, info string, fields []Field) {
+	if len(l.fields) > 0 {
+		fields = mergeFields(append(make([]Field, 0, len(l.fields)+len(fields)), l.fields...), fields)
+	}
+	if rd := l.redactor.Load().(*Redactor); rd != nil {
+		info, fields = rd.redact(info, fields)
+	}
+	fields = l.fieldOrder.Load().(*fieldOrder).apply(fields)
+	r := l.newRecord(level, code, info, fields)
+	r.fn = fn
+	l.send(r)
+}
 
+func (l *Logger) send(r *Record) {
+	l.tunnelMutex.RLock()
+	if l.closed {
+		l.recordPool.Put(r)
+	} else if l.syncMode {
+		l.syncMutex.Lock()
+		l.dispatch(r)
+		l.syncMutex.Unlock()
+	} else {
+		l.sendToTunnel(r)
 	}
+	l.tunnelMutex.RUnlock()
+}
+
+func (l *Logger) newRecord(level int, code string, info string, fields []Field) *Record {
+	now := time.Now()
 	r := l.recordPool.Get().(*Record)
-	r.info = inf
+	r.info = info
 	r.code = code
-	r.time = l.lastTimeStr
+	r.fn = ""
+	r.t = now
+	r.time = l.formatTime(now)
 	r.level = level
-
-	l.tunnel <- r
+	r.fields = fields
+	return r
 }
 
-func boostrapLogWriter(logger *Logger) {
-	if logger == nil {
-		panic("logger is nil")
-	}
-
+func (l *Logger) dispatch(r *Record) {
+	// 同步模式没有Writer队列，调用方已持有tunnelMutex读锁
 	var (
-		r  *Record
-		ok bool
+		policy  int
+		timeout time.Duration
 	)
+	if !l.syncMode {
+		l.tunnelMutex.RLock()
+		policy, timeout = l.overflowPolicy, l.blockTimeout
+		l.tunnelMutex.RUnlock()
+	}
+	l.workersMutex.RLock()
+	atomic.StoreInt32(&r.refs, int32(len(l.workers)))
+	if len(l.workers) == 0 {
+		l.recordPool.Put(r)
+	}
+	for _, ww := range l.workers {
+		ww.deliver(r, policy, timeout)
+	}
+	l.workersMutex.RUnlock()
+}
 
-	if r, ok = <-logger.tunnel; !ok {
-		logger.c <- true
-		return
+// 当前tunnel被关闭后，如果是SetTunnelSize替换的则返回新的tunnel
+func (l *Logger) nextTunnel() chan *Record {
+	select {
+	case tunnel := <-l.tunnelSwitch:
+		return tunnel
+	default:
+		return nil
 	}
+}
 
-	for _, w := range logger.writers {
-		if err := w.Write(r); err != nil {
-			log.Println(err)
-		}
+// 将记录分发到各Writer的队列，写入、flush、rotate由各Writer的goroutine完成
+func boostrapLogWriter(logger *Logger) {
+	if logger == nil {
+		panic("logger is nil")
 	}
 
-	flushTimer := time.NewTimer(time.Millisecond * 500)
-	rotateTimer := time.NewTimer(time.Second * 10)
+	logger.tunnelMutex.RLock()
+	tunnel := logger.tunnel
+	logger.tunnelMutex.RUnlock()
 
-	for {
+	reportTicker := time.NewTicker(dropReportInterval)
+	defer reportTicker.Stop()
+
+	for tunnel != nil {
 		select {
-		case r, ok = <-logger.tunnel:
+		case r, ok := <-tunnel:
 			if !ok {
-				logger.c <- true
-				return
-			}
-			for _, w := range logger.writers {
-				if err := w.Write(r); err != nil {
-					log.Println(err)
-				}
+				tunnel = logger.nextTunnel()
+				continue
 			}
+			logger.dispatch(r)
 
-			logger.recordPool.Put(r)
-
-		case <-flushTimer.C:
-			for _, w := range logger.writers {
-				if f, ok := w.(Flusher); ok {
-					if err := f.Flush(); err != nil {
-						log.Println(err)
-					}
-				}
-			}
-			flushTimer.Reset(time.Millisecond * 1000)
-
-		case <-rotateTimer.C:
-			for _, w := range logger.writers {
-				if r, ok := w.(Rotater); ok {
-					if err := r.Rotate(); err != nil {
-						log.Println(err)
-					}
-				}
-			}
-			rotateTimer.Reset(time.Second * 10)
+		case <-reportTicker.C:
+			logger.reportDropped(tunnel)
 		}
 	}
+	logger.reportDropped(nil)
+
+	logger.workersMutex.RLock()
+	for _, ww := range logger.workers {
+		ww.close()
+	}
+	logger.workersMutex.RUnlock()
+	logger.c <- true
 }
 
 // default logger
-var (
-	logger_default *Logger
-	takeup         = false
-)
-
 func SetLevel(lvl int) {
-	defaultLoggerInit()
-	logger_default.level = lvl
+	Default().SetLevel(lvl)
 }
 
 func SetLayout(layout string) {
-	defaultLoggerInit()
-	logger_default.layout = layout
+	Default().SetLayout(layout)
 }
 
 func SetLoadLocation(loadLocation string) {
-	defaultLoggerInit()
-	logger_default.loadLocation, _ = time.LoadLocation(loadLocation)
+	Default().SetLoadLocation(loadLocation)
 }
 
 func Trace(fmt string, args ...interface{}) {
-	defaultLoggerInit()
-	logger_default.deliverRecordToWriter(TRACE, fmt, args...)
+	Default().deliverRecordToWriter(0, TRACE, nil, fmt, args...)
 }
 
 func Debug(fmt string, args ...interface{}) {
-	defaultLoggerInit()
-	logger_default.deliverRecordToWriter(DEBUG, fmt, args...)
+	Default().deliverRecordToWriter(0, DEBUG, nil, fmt, args...)
 }
 
 func Warn(fmt string, args ...interface{}) {
-	defaultLoggerInit()
-	logger_default.deliverRecordToWriter(WARNING, fmt, args...)
+	Default().deliverRecordToWriter(0, WARNING, nil, fmt, args...)
 }
 
 func Info(fmt string, args ...interface{}) {
-	defaultLoggerInit()
-	logger_default.deliverRecordToWriter(INFO, fmt, args...)
+	Default().deliverRecordToWriter(0, INFO, nil, fmt, args...)
 }
 
 func Error(fmt string, args ...interface{}) {
-	defaultLoggerInit()
-	logger_default.deliverRecordToWriter(ERROR, fmt, args...)
+	Default().deliverRecordToWriter(0, ERROR, nil, fmt, args...)
 }
 
 func Fatal(fmt string, args ...interface{}) {
-	defaultLoggerInit()
-	logger_default.deliverRecordToWriter(FATAL, fmt, args...)
+	Default().deliverRecordToWriter(0, FATAL, nil, fmt, args...)
+}
+
+func Log(level int, msg string, fields ...Field) {
+	Default().deliverRecordToWriter(0, level, fields, "", msg)
+}
+
+func LogDepth(depth int, level int, msg string, fields ...Field) {
+	Default().deliverRecordToWriter(depth, level, fields, "", msg)
+}
+
+// 绑定字段的default Logger
+func With(fields ...Field) *Logger {
+	return Default().With(fields...)
 }
 
 func Register(w Writer) {
-	defaultLoggerInit()
-	logger_default.Register(w)
+	Default().Register(w)
 }
 
-func Close() {
-	defaultLoggerInit()
-	logger_default.Close()
-	logger_default = nil
-	takeup = false
+func Stats() []WriterStat {
+	return Default().Stats()
 }
 
-func defaultLoggerInit() {
-	if takeup == false {
-		logger_default = NewLogger()
-	}
+// 关闭default Logger，之后再使用时会重新创建
+func Close() {
+	CloseLogger(DefaultLoggerName)
 }
@@ -0,0 +1,267 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	net_buffer_size_default = 1 << 20
+	net_batch_size          = 32 << 10
+	net_backoff_min         = 500 * time.Millisecond
+	net_backoff_max         = 30 * time.Second
+	net_write_timeout       = 5 * time.Second
+)
+
+var errNetBufferFull = errors.New("net writer buffer is full")
+
+// 以换行分隔的记录发送到tcp/udp收集端。
+// 未发送的记录先缓存在内存中，内存缓存满后转存到spill文件，重连后按顺序补发
+type NetWriter struct {
+	network     string
+	addr        string
+	formatter   Formatter
+	conn        net.Conn
+	buf         bytes.Buffer
+	bufferSize  int
+	spillPath   string
+	spillFile   *os.File
+	spillOffset int64
+	spillSize   int64
+	maxSpill    int64
+	backoff     time.Duration
+	retryAt     time.Time
+}
+
+func NewNetWriter() *NetWriter {
+	return &NetWriter{
+		bufferSize: net_buffer_size_default,
+	}
+}
+
+// network: tcp、udp
+func (w *NetWriter) SetAddr(network, addr string) {
+	w.network = network
+	w.addr = addr
+}
+
+func (w *NetWriter) SetFormatter(f Formatter) {
+	w.formatter = f
+}
+
+// 内存缓存的最大字节数
+func (w *NetWriter) SetBufferSize(size int) {
+	if size > 0 {
+		w.bufferSize = size
+	}
+}
+
+// 收集端不可用且内存缓存满时写入的文件，空字符串表示直接丢弃
+func (w *NetWriter) SetSpillPath(path string) {
+	w.spillPath = path
+}
+
+// spill文件的最大字节数，0表示不限制
+func (w *NetWriter) SetMaxSpillSize(size int64) {
+	w.maxSpill = size
+}
+
+func (w *NetWriter) Init() error {
+	switch w.network {
+	case "tcp", "udp":
+	default:
+		return errors.New("Invalid net writer network (" + w.network + ")")
+	}
+	if w.addr == "" {
+		return errors.New("net writer addr is empty")
+	}
+	if w.spillPath != "" {
+		if err := os.MkdirAll(path.Dir(w.spillPath), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(w.spillPath, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		w.spillFile = file
+		// 上次未补发的记录
+		if info, err := file.Stat(); err == nil {
+			w.spillSize = info.Size()
+		}
+	}
+	// 收集端暂时不可用不影响启动
+	w.connect()
+	return nil
+}
+
+func (w *NetWriter) Write(r *Record) (err error) {
+	var line string
+	if w.formatter != nil {
+		line = w.formatter.Format(r)
+	} else {
+		line = r.String()
+	}
+	if w.buf.Len()+len(line) > w.bufferSize {
+		if err = w.Flush(); w.buf.Len()+len(line) > w.bufferSize {
+			err = w.spill()
+		}
+	}
+	w.buf.WriteString(line)
+	if w.conn != nil && w.buf.Len() >= net_batch_size {
+		err = w.Flush()
+	}
+	return
+}
+
+// 先补发spill文件，再发送内存缓存
+func (w *NetWriter) Flush() error {
+	if w.spillSize == 0 && w.buf.Len() == 0 {
+		return nil
+	}
+	if w.conn == nil {
+		// 等待重连期间的记录留在缓存中
+		if time.Now().Before(w.retryAt) {
+			return nil
+		}
+		if err := w.connect(); err != nil {
+			return err
+		}
+	}
+	if err := w.sendSpill(); err != nil {
+		w.disconnect()
+		return err
+	}
+	for w.buf.Len() > 0 {
+		n, err := w.send(w.buf.Bytes())
+		w.buf.Next(completeLines(w.buf.Bytes(), n))
+		if err != nil {
+			w.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+// 关闭时无法发送的记录转存到spill文件
+func (w *NetWriter) Close() error {
+	err := w.Flush()
+	if w.buf.Len() > 0 && w.spillFile != nil {
+		err = w.spill()
+	}
+	if w.spillFile != nil {
+		w.spillFile.Close()
+	}
+	w.disconnect()
+	return err
+}
+
+func (w *NetWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.addr, net_write_timeout)
+	if err != nil {
+		w.delayRetry()
+		return err
+	}
+	w.conn = conn
+	w.backoff = 0
+	return nil
+}
+
+// 连接失败后按指数退避重连
+func (w *NetWriter) delayRetry() {
+	if w.backoff == 0 {
+		w.backoff = net_backoff_min
+	} else if w.backoff *= 2; w.backoff > net_backoff_max {
+		w.backoff = net_backoff_max
+	}
+	w.retryAt = time.Now().Add(w.backoff)
+}
+
+func (w *NetWriter) disconnect() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+		w.delayRetry()
+	}
+}
+
+// 已完整发送的行的字节数
+// tcp只写入了半行时连接会被关闭，该行在新连接上从头重发，收集端不会收到拼接错误的行
+func completeLines(data []byte, n int) int {
+	if n >= len(data) {
+		return n
+	}
+	return bytes.LastIndexByte(data[:n], '\n') + 1
+}
+
+// 返回已发送的字节数，udp每行一个数据报
+func (w *NetWriter) send(data []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(net_write_timeout))
+	if w.network == "tcp" {
+		return w.conn.Write(data)
+	}
+	sent := 0
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		if _, err := w.conn.Write(line); err != nil {
+			return sent, err
+		}
+		sent += len(line)
+		data = data[len(line):]
+	}
+	return sent, nil
+}
+
+func (w *NetWriter) sendSpill() error {
+	if w.spillFile == nil || w.spillSize == 0 {
+		return nil
+	}
+	chunk := make([]byte, net_batch_size)
+	for w.spillOffset < w.spillSize {
+		n, err := w.spillFile.ReadAt(chunk, w.spillOffset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		// 按整行发送，重连后从行首继续
+		data := chunk[:n]
+		if w.spillOffset+int64(n) < w.spillSize {
+			if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+				data = data[:i+1]
+			}
+		}
+		sent, err := w.send(data)
+		if err != nil {
+			w.spillOffset += int64(completeLines(data, sent))
+			return err
+		}
+		w.spillOffset += int64(sent)
+	}
+	if err := w.spillFile.Truncate(0); err != nil {
+		return err
+	}
+	w.spillOffset = 0
+	w.spillSize = 0
+	return nil
+}
+
+// 内存缓存写入spill文件
+func (w *NetWriter) spill() error {
+	if w.spillFile == nil || (w.maxSpill > 0 && w.spillSize+int64(w.buf.Len()) > w.maxSpill) {
+		w.buf.Reset()
+		return errNetBufferFull
+	}
+	n, err := w.spillFile.WriteAt(w.buf.Bytes(), w.spillSize)
+	w.spillSize += int64(n)
+	w.buf.Next(n)
+	return err
+}
@@ -0,0 +1,125 @@
+package log_test
+
+import (
+	"bufio"
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 按行读取的tcp收集端
+func newLineServer(t *testing.T, addr string) chan string {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	lines := make(chan string, 1000)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				s := bufio.NewScanner(conn)
+				for s.Scan() {
+					lines <- s.Text()
+				}
+			}()
+		}
+	}()
+	return lines
+}
+
+// 已关闭的本地端口，模拟不可用的收集端
+func unusedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func newNetLogger(addr, spillPath string) (*log.Logger, *logtest.Recorder) {
+	l, rec := logtest.NewLogger()
+	w := log.NewNetWriter()
+	w.SetAddr("tcp", addr)
+	w.SetBufferSize(256)
+	w.SetSpillPath(spillPath)
+	l.Register(w)
+	return l, rec
+}
+
+// 收集端收到的行与记录的日志按顺序一一对应
+func expectLines(t *testing.T, lines chan string, entries []logtest.Entry) {
+	t.Helper()
+	for i, e := range entries {
+		select {
+		case line := <-lines:
+			if !strings.HasSuffix(line, " "+e.Message) {
+				t.Fatalf("line %d = %q, want message %q", i, line, e.Message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d lines", i, len(entries))
+		}
+	}
+	select {
+	case line := <-lines:
+		t.Fatalf("unexpected line %q", line)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNetWriterSpillAndReplay(t *testing.T) {
+	addr := unusedAddr(t)
+	spillPath := filepath.Join(t.TempDir(), "net.spill")
+
+	l, rec := newNetLogger(addr, spillPath)
+	for i := 0; i < 30; i++ {
+		l.Info("down-%03d", i)
+	}
+	if info, err := os.Stat(spillPath); err != nil || info.Size() == 0 {
+		t.Fatalf("records were not spilled: %v", err)
+	}
+
+	// 收集端恢复后，退避结束时先补发spill文件再发送内存缓存
+	lines := newLineServer(t, addr)
+	time.Sleep(600 * time.Millisecond)
+	l.Info("up")
+	l.Close()
+
+	expectLines(t, lines, rec.Entries())
+	if info, err := os.Stat(spillPath); err != nil || info.Size() != 0 {
+		t.Fatalf("spill file not truncated after replay: %v", err)
+	}
+}
+
+func TestNetWriterReplayAfterRestart(t *testing.T) {
+	addr := unusedAddr(t)
+	spillPath := filepath.Join(t.TempDir(), "net.spill")
+
+	// 关闭时未发送的记录全部转存到spill文件
+	l, rec := newNetLogger(addr, spillPath)
+	for i := 0; i < 30; i++ {
+		l.Info("before-restart-%03d", i)
+	}
+	l.Close()
+	entries := rec.Entries()
+
+	lines := newLineServer(t, addr)
+	l, rec = newNetLogger(addr, spillPath)
+	l.Info("after-restart")
+	l.Close()
+
+	expectLines(t, lines, append(entries, rec.Entries()...))
+}
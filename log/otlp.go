@@ -0,0 +1,241 @@
+package log
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OTLP请求体的编码方式
+const (
+	OTLPEncodingJSON     = "json"
+	OTLPEncodingProtobuf = "protobuf"
+)
+
+const otlpScopeName = "github.com/xiaka53/DeployAndLog/log"
+
+// OTLP severity number，按 TRACE..FATAL 的顺序
+var otlpSeverity = [...]int{1, 5, 9, 13, 17, 21}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string                 `json:"timeUnixNano"`
+	ObservedTimeUnixNano string                 `json:"observedTimeUnixNano"`
+	SeverityNumber       int                    `json:"severityNumber"`
+	SeverityText         string                 `json:"severityText"`
+	Body                 map[string]interface{} `json:"body"`
+	Attributes           []otlpKeyValue         `json:"attributes,omitempty"`
+	TraceId              string                 `json:"traceId,omitempty"`
+	SpanId               string                 `json:"spanId,omitempty"`
+}
+
+// 单条记录的OTLP编码，traceid/spanid为合法的16/8字节十六进制时写入trace字段，否则作为属性
+func encodeOTLPRecord(r *Record, encoding string) string {
+	var (
+		body    = r.info
+		traceId []byte
+		spanId  []byte
+		attrs   = make([]Field, 0, len(r.fields)+2)
+	)
+	for _, f := range r.fields {
+		switch f.Key {
+		case FieldTraceId:
+			if id, err := hex.DecodeString(f.Text()); err == nil && len(id) == 16 {
+				traceId = id
+				continue
+			}
+		case FieldSpanId:
+			if id, err := hex.DecodeString(f.Text()); err == nil && len(id) == 8 {
+				spanId = id
+				continue
+			}
+		}
+		if f.Key == FieldDLTag && body == "" {
+			body = f.Text()
+		}
+		attrs = append(attrs, f)
+	}
+	if r.code != "" {
+		attrs = append(attrs, String("caller", r.code))
+	}
+	if r.fn != "" {
+		attrs = append(attrs, String("func", r.fn))
+	}
+	ts := uint64(r.t.UnixNano())
+
+	if encoding == OTLPEncodingProtobuf {
+		var b []byte
+		b = appendProtoFixed64(b, 1, ts)
+		b = appendProtoVarint(b, 2, uint64(otlpSeverity[r.level]))
+		b = appendProtoBytes(b, 3, []byte(LEVEL_FLAGS[r.level]))
+		b = appendProtoBytes(b, 5, appendProtoBytes(nil, 1, []byte(body)))
+		for _, f := range attrs {
+			b = appendProtoBytes(b, 6, encodeOTLPKeyValueProto(f))
+		}
+		if traceId != nil {
+			b = appendProtoBytes(b, 9, traceId)
+		}
+		if spanId != nil {
+			b = appendProtoBytes(b, 10, spanId)
+		}
+		b = appendProtoFixed64(b, 11, ts)
+		return string(b)
+	}
+
+	lr := otlpLogRecord{
+		TimeUnixNano:         strconv.FormatUint(ts, 10),
+		ObservedTimeUnixNano: strconv.FormatUint(ts, 10),
+		SeverityNumber:       otlpSeverity[r.level],
+		SeverityText:         LEVEL_FLAGS[r.level],
+		Body:                 map[string]interface{}{"stringValue": body},
+		TraceId:              hex.EncodeToString(traceId),
+		SpanId:               hex.EncodeToString(spanId),
+	}
+	for _, f := range attrs {
+		lr.Attributes = append(lr.Attributes, otlpKeyValue{Key: f.Key, Value: otlpAnyValue(f)})
+	}
+	b, _ := json.Marshal(lr)
+	return string(b)
+}
+
+// 批量请求体，records为encodeOTLPRecord的结果
+func encodeOTLPRequest(resource map[string]string, records []string, encoding string) []byte {
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if encoding == OTLPEncodingProtobuf {
+		var res, scope, scopeLogs, resourceLogs []byte
+		for _, k := range keys {
+			res = appendProtoBytes(res, 1, encodeOTLPKeyValueProto(String(k, resource[k])))
+		}
+		scope = appendProtoBytes(scope, 1, []byte(otlpScopeName))
+		scopeLogs = appendProtoBytes(scopeLogs, 1, scope)
+		for _, r := range records {
+			scopeLogs = appendProtoBytes(scopeLogs, 2, []byte(r))
+		}
+		resourceLogs = appendProtoBytes(resourceLogs, 1, res)
+		resourceLogs = appendProtoBytes(resourceLogs, 2, scopeLogs)
+		return appendProtoBytes(nil, 1, resourceLogs)
+	}
+
+	attrs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpKeyValue{Key: k, Value: map[string]interface{}{"stringValue": resource[k]}})
+	}
+	resBytes, _ := json.Marshal(map[string]interface{}{"attributes": attrs})
+	scopeBytes, _ := json.Marshal(map[string]string{"name": otlpScopeName})
+	return []byte(`{"resourceLogs":[{"resource":` + string(resBytes) +
+		`,"scopeLogs":[{"scope":` + string(scopeBytes) +
+		`,"logRecords":[` + strings.Join(records, ",") + `]}]}]}`)
+}
+
+// OTLP/JSON中int64以字符串表示
+func otlpAnyValue(f Field) map[string]interface{} {
+	switch f.Type {
+	case IntType:
+		if v, ok := fieldInt64(f.Value); ok {
+			return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		}
+	case FloatType:
+		if v, ok := fieldFloat64(f.Value); ok {
+			return map[string]interface{}{"doubleValue": v}
+		}
+	}
+	return map[string]interface{}{"stringValue": otlpStringValue(f)}
+}
+
+func encodeOTLPKeyValueProto(f Field) []byte {
+	var value []byte
+	switch f.Type {
+	case IntType:
+		if v, ok := fieldInt64(f.Value); ok {
+			value = appendProtoVarint(value, 3, uint64(v))
+		}
+	case FloatType:
+		if v, ok := fieldFloat64(f.Value); ok {
+			value = appendProtoFixed64(value, 4, math.Float64bits(v))
+		}
+	}
+	if value == nil {
+		value = appendProtoBytes(value, 1, []byte(otlpStringValue(f)))
+	}
+	b := appendProtoBytes(nil, 1, []byte(f.Key))
+	return appendProtoBytes(b, 2, value)
+}
+
+// map等复合类型以JSON字符串表示
+func otlpStringValue(f Field) string {
+	if f.Type == MapType || f.Type == AnyType {
+		if b, err := json.Marshal(f.JSONValue()); err == nil {
+			return string(b)
+		}
+	}
+	return f.Text()
+}
+
+func fieldInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+func fieldFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = appendProtoTag(b, field, 0)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoFixed64(b []byte, field int, v uint64) []byte {
+	b = appendProtoTag(b, field, 1)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+func appendProtoBytes(b []byte, field int, v []byte) []byte {
+	b = appendProtoTag(b, field, 2)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
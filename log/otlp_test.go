@@ -0,0 +1,114 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"strconv"
+	"testing"
+)
+
+func TestOTLPJSON(t *testing.T) {
+	url, requests := newHTTPCollector(t, "{}")
+	w := log.NewHTTPWriter()
+	w.SetEndpoint(log.HTTPModeOTLP, url+"/v1/logs")
+	w.SetResource("service.name", "svc")
+	l, rec := newHTTPLogger(w)
+	traceId, spanId := "0123456789abcdef0123456789abcdef", "0123456789abcdef"
+	l.Log(log.ERROR, "query failed", log.String(log.FieldDLTag, "_com_mysql_failure"),
+		log.String(log.FieldTraceId, traceId), log.String(log.FieldSpanId, spanId), log.Int("rows", 3))
+	l.Close()
+
+	req := receiveRequest(t, requests)
+	if ct := req.header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	type keyValue struct {
+		Key   string            `json:"key"`
+		Value map[string]string `json:"value"`
+	}
+	var export struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []keyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				Scope struct {
+					Name string `json:"name"`
+				} `json:"scope"`
+				LogRecords []struct {
+					TimeUnixNano   string            `json:"timeUnixNano"`
+					SeverityNumber int               `json:"severityNumber"`
+					SeverityText   string            `json:"severityText"`
+					Body           map[string]string `json:"body"`
+					Attributes     []keyValue        `json:"attributes"`
+					TraceId        string            `json:"traceId"`
+					SpanId         string            `json:"spanId"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(req.body, &export); err != nil {
+		t.Fatalf("%v: %s", err, req.body)
+	}
+	if len(export.ResourceLogs) != 1 || len(export.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatalf("unexpected layout: %s", req.body)
+	}
+	res := export.ResourceLogs[0].Resource.Attributes
+	if len(res) != 1 || res[0].Key != "service.name" || res[0].Value["stringValue"] != "svc" {
+		t.Errorf("resource attributes = %v", res)
+	}
+	scope := export.ResourceLogs[0].ScopeLogs[0]
+	if scope.Scope.Name == "" || len(scope.LogRecords) != 1 {
+		t.Fatalf("unexpected scope logs: %s", req.body)
+	}
+
+	e := rec.Expect(t, logtest.DLTag("_com_mysql_failure"))
+	lr := scope.LogRecords[0]
+	if lr.TimeUnixNano != strconv.FormatInt(e.Time.UnixNano(), 10) {
+		t.Errorf("timeUnixNano = %s, want %d", lr.TimeUnixNano, e.Time.UnixNano())
+	}
+	if lr.SeverityNumber != 17 || lr.SeverityText != "ERROR" || lr.Body["stringValue"] != e.Message {
+		t.Errorf("severity/body = %d %s %v", lr.SeverityNumber, lr.SeverityText, lr.Body)
+	}
+	if lr.TraceId != traceId || lr.SpanId != spanId {
+		t.Errorf("traceId/spanId = %s/%s", lr.TraceId, lr.SpanId)
+	}
+	// traceid、spanid写入trace字段，不再作为属性
+	attrs := map[string]map[string]string{}
+	for _, kv := range lr.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["rows"]["intValue"] != "3" || attrs[log.FieldDLTag]["stringValue"] != "_com_mysql_failure" || attrs["caller"]["stringValue"] != e.Code {
+		t.Errorf("attributes = %v", attrs)
+	}
+	if _, ok := attrs[log.FieldTraceId]; ok {
+		t.Errorf("traceid kept as attribute: %v", attrs)
+	}
+}
+
+func TestOTLPProtobuf(t *testing.T) {
+	url, requests := newHTTPCollector(t, "")
+	w := log.NewHTTPWriter()
+	w.SetEndpoint(log.HTTPModeOTLP, url+"/v1/logs")
+	w.SetOTLPEncoding(log.OTLPEncodingProtobuf)
+	w.SetResource("service.name", "svc")
+	l, _ := newHTTPLogger(w)
+	l.Error("query failed")
+	l.Close()
+
+	req := receiveRequest(t, requests)
+	if ct := req.header.Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	// ExportLogsServiceRequest.resource_logs 为字段1的length-delimited
+	if len(req.body) == 0 || req.body[0] != 1<<3|2 {
+		t.Fatalf("body does not start with resource_logs: %x", req.body)
+	}
+	for _, s := range []string{"service.name", "svc", "query failed", "ERROR"} {
+		if !bytes.Contains(req.body, []byte(s)) {
+			t.Errorf("body does not contain %q", s)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package log
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// tunnel或Writer队列写满时的处理策略
+const (
+	OverflowBlock        = iota // 阻塞直到有空位
+	OverflowDropNewest          // 丢弃当前记录
+	OverflowDropOldest          // 丢弃队列中最旧的记录
+	OverflowBlockTimeout        // 阻塞一段时间，超时后丢弃当前记录
+)
+
+const dropReportInterval = time.Second
+
+// block_timeout未设置等待时间时使用
+const block_timeout_default = 100 * time.Millisecond
+
+func ParseOverflowPolicy(policy string) (int, error) {
+	switch policy {
+	case "", "block":
+		return OverflowBlock, nil
+
+	case "drop_newest":
+		return OverflowDropNewest, nil
+
+	case "drop_oldest":
+		return OverflowDropOldest, nil
+
+	case "block_timeout":
+		return OverflowBlockTimeout, nil
+	}
+	return 0, errors.New("Invalid overflow policy (" + policy + ")")
+}
+
+// timeout只对OverflowBlockTimeout有效，不大于0时为100ms
+func (l *Logger) SetOverflowPolicy(policy int, timeout time.Duration) {
+	if policy == OverflowBlockTimeout && timeout <= 0 {
+		timeout = block_timeout_default
+	}
+	l.tunnelMutex.Lock()
+	l.overflowPolicy = policy
+	l.blockTimeout = timeout
+	l.tunnelMutex.Unlock()
+}
+
+// 修改tunnel长度，旧tunnel中的记录会先分发完
+func (l *Logger) SetTunnelSize(size int) {
+	if size <= 0 {
+		return
+	}
+	l.tunnelMutex.Lock()
+	defer l.tunnelMutex.Unlock()
+	if l.closed || cap(l.tunnel) == size {
+		return
+	}
+	old := l.tunnel
+	l.tunnel = make(chan *Record, size)
+	l.tunnelSwitch <- l.tunnel
+	close(old)
+}
+
+// 各级别被丢弃的记录数
+func (l *Logger) Dropped() map[string]uint64 {
+	m := make(map[string]uint64, len(LEVEL_FLAGS))
+	for i, name := range LEVEL_FLAGS {
+		m[name] = atomic.LoadUint64(&l.dropped[i])
+	}
+	return m
+}
+
+// 调用方需持有tunnelMutex读锁
+func (l *Logger) sendToTunnel(r *Record) {
+	switch l.overflowPolicy {
+	case OverflowDropNewest:
+		select {
+		case l.tunnel <- r:
+		default:
+			l.dropRecord(r)
+		}
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case l.tunnel <- r:
+				return
+			default:
+			}
+			select {
+			case old := <-l.tunnel:
+				l.dropRecord(old)
+			default:
+			}
+		}
+
+	case OverflowBlockTimeout:
+		select {
+		case l.tunnel <- r:
+			return
+		default:
+		}
+		timer := time.NewTimer(l.blockTimeout)
+		select {
+		case l.tunnel <- r:
+		case <-timer.C:
+			l.dropRecord(r)
+		}
+		timer.Stop()
+
+	default:
+		l.tunnel <- r
+	}
+}
+
+func (l *Logger) dropRecord(r *Record) {
+	l.countDropped(r)
+	l.recordPool.Put(r)
+}
+
+// tunnel和Writer队列丢弃的记录都计入按级别的统计
+func (l *Logger) countDropped(r *Record) {
+	atomic.AddUint64(&l.dropped[r.level], 1)
+}
+
+// tunnel压力解除后输出一条丢弃统计
+func (l *Logger) reportDropped(tunnel chan *Record) {
+	var (
+		total uint64
+		delta [len(LEVEL_FLAGS)]uint64
+	)
+	for i := range LEVEL_FLAGS {
+		delta[i] = atomic.LoadUint64(&l.dropped[i]) - l.droppedReported[i]
+		total += delta[i]
+	}
+	if total == 0 {
+		return
+	}
+
+	if tunnel != nil && len(tunnel) > cap(tunnel)/2 {
+		return
+	}
+
+	fields := make([]Field, 0, len(delta))
+	for i, d := range delta {
+		l.droppedReported[i] += d
+		if d > 0 {
+			fields = append(fields, Field{Key: strings.ToLower(LEVEL_FLAGS[i]), Type: IntType, Value: d})
+		}
+	}
+	l.dispatch(l.newRecord(WARNING, "", strconv.FormatUint(total, 10)+" records dropped", fields))
+}
@@ -0,0 +1,493 @@
+package log
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// 脱敏方式
+const (
+	RedactFull    = "full"
+	RedactPartial = "partial"
+	RedactHash    = "hash"
+)
+
+// full方式的替换内容，不体现原值长度
+const redact_full_mask = "******"
+
+// 嵌套结构的最大处理层数，避免循环引用
+const redact_max_depth = 8
+
+// 脱敏规则，Keys和Pattern至少设置一个
+type RedactRule struct {
+	// 字段名，不区分大小写，同时匹配map、url.Values中的key，JSON和查询字符串中的同名参数，
+	// 以及redis命令等参数列表中该名称之后的值
+	Keys []string
+	// 正则，匹配到的内容脱敏，如手机号、身份证号、银行卡号
+	Pattern string
+	// 只对这些dltag的日志生效，为空时对全部日志生效
+	DLTags []string
+	// full(默认)、partial、hash
+	Style string
+	// hash方式的HMAC密钥，手机号等取值范围小的内容不加密钥可以被穷举还原
+	HashKey string
+}
+
+type redactRule struct {
+	keys    map[string]bool
+	jsonKey *regexp.Regexp
+	formKey *regexp.Regexp
+	pattern *regexp.Regexp
+	dltags  map[string]bool
+	mask    func(string) string
+}
+
+// 在日志进入各Writer之前对字段和内容脱敏
+type Redactor struct {
+	rules []*redactRule
+}
+
+func NewRedactor(rules []RedactRule) (*Redactor, error) {
+	r := &Redactor{}
+	for _, rule := range rules {
+		rr, err := newRedactRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rr)
+	}
+	return r, nil
+}
+
+func newRedactRule(rule RedactRule) (*redactRule, error) {
+	if len(rule.Keys) == 0 && rule.Pattern == "" {
+		return nil, errors.New("redact rule needs keys or pattern")
+	}
+	rr := &redactRule{}
+	switch strings.ToLower(rule.Style) {
+	case "", RedactFull:
+		rr.mask = maskFull
+	case RedactPartial:
+		rr.mask = maskPartial
+	case RedactHash:
+		if rule.HashKey == "" {
+			return nil, errors.New("redact hash style needs hash key")
+		}
+		key := []byte(rule.HashKey)
+		rr.mask = func(s string) string {
+			return maskHash(key, s)
+		}
+	default:
+		return nil, errors.New("Invalid redact style (" + rule.Style + ")")
+	}
+	if len(rule.Keys) > 0 {
+		rr.keys = make(map[string]bool, len(rule.Keys))
+		quoted := make([]string, 0, len(rule.Keys))
+		for _, key := range rule.Keys {
+			rr.keys[strings.ToLower(key)] = true
+			quoted = append(quoted, regexp.QuoteMeta(key))
+		}
+		keys := strings.Join(quoted, "|")
+		rr.jsonKey = regexp.MustCompile(`(?i)("(?:` + keys + `)"\s*:\s*)("(?:[^"\\]|\\.)*"|[^,}\]\s]+)`)
+		rr.formKey = regexp.MustCompile(`(?i)((?:^|[?&\s;])(?:` + keys + `)=)([^&\s";]+)`)
+	}
+	if rule.Pattern != "" {
+		var err error
+		if rr.pattern, err = regexp.Compile(rule.Pattern); err != nil {
+			return nil, errors.New("Invalid redact pattern (" + rule.Pattern + "): " + err.Error())
+		}
+	}
+	if len(rule.DLTags) > 0 {
+		rr.dltags = make(map[string]bool, len(rule.DLTags))
+		for _, tag := range rule.DLTags {
+			rr.dltags[tag] = true
+		}
+	}
+	return rr, nil
+}
+
+// 脱敏规则，nil表示不脱敏
+func (l *Logger) SetRedactor(r *Redactor) {
+	l.redactor.Store(r)
+}
+
+// 只在需要脱敏时复制字段，不修改调用方的数据
+func (r *Redactor) redact(info string, fields []Field) (string, []Field) {
+	var dltag string
+	for _, f := range fields {
+		if f.Key == FieldDLTag {
+			dltag = f.Text()
+			break
+		}
+	}
+	copied := false
+	for _, rule := range r.rules {
+		if rule.dltags != nil && !rule.dltags[dltag] {
+			continue
+		}
+		info = rule.redactText(info)
+		for i, f := range fields {
+			switch f.Key {
+			case FieldDLTag, FieldTraceId, FieldSpanId, FieldCSpanId:
+				continue
+			}
+			nf, changed := rule.redactField(f)
+			if !changed {
+				continue
+			}
+			if !copied {
+				fields = append([]Field(nil), fields...)
+				copied = true
+			}
+			fields[i] = nf
+		}
+	}
+	return info, fields
+}
+
+func (rule *redactRule) redactField(f Field) (Field, bool) {
+	if rule.keys[strings.ToLower(f.Key)] {
+		return String(f.Key, rule.mask(f.Text())), true
+	}
+	switch f.Type {
+	case IntType, FloatType, DurationType:
+		if rule.pattern == nil {
+			return f, false
+		}
+		text := f.Text()
+		if masked := rule.redactText(text); masked != text {
+			return String(f.Key, masked), true
+		}
+		return f, false
+	case ErrorType:
+		if f.Value == nil {
+			return f, false
+		}
+		text := f.Text()
+		if masked := rule.redactText(text); masked != text {
+			return Err(f.Key, errors.New(masked)), true
+		}
+		return f, false
+	}
+	v, changed := rule.redactValue(f.Value, 0)
+	if !changed {
+		return f, false
+	}
+	if s, ok := v.(string); ok && f.Type != StringType {
+		return String(f.Key, s), true
+	}
+	return Field{Key: f.Key, Type: f.Type, Value: v}, true
+}
+
+// map、切片按元素处理，其他类型按文本处理
+func (rule *redactRule) redactValue(v interface{}, depth int) (interface{}, bool) {
+	if depth > redact_max_depth {
+		return v, false
+	}
+	switch val := v.(type) {
+	case nil:
+		return v, false
+	case string:
+		masked := rule.redactText(val)
+		return masked, masked != val
+	case []byte:
+		text := string(val)
+		masked := rule.redactText(text)
+		return masked, masked != text
+	case []interface{}:
+		var out []interface{}
+		for i, e := range val {
+			var (
+				nv      interface{}
+				changed bool
+			)
+			if i > 0 && rule.isKey(val[i-1]) {
+				nv, changed = rule.mask(fmt.Sprintf("%v", e)), true
+			} else {
+				nv, changed = rule.redactValue(e, depth+1)
+			}
+			if changed {
+				if out == nil {
+					out = append([]interface{}(nil), val...)
+				}
+				out[i] = nv
+			}
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	case []string:
+		var out []string
+		for i, e := range val {
+			nv := rule.redactText(e)
+			if i > 0 && rule.isKey(val[i-1]) {
+				nv = rule.mask(e)
+			}
+			if nv != e {
+				if out == nil {
+					out = append([]string(nil), val...)
+				}
+				out[i] = nv
+			}
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	case map[string]interface{}:
+		var out map[string]interface{}
+		for k, e := range val {
+			var (
+				nv      interface{}
+				changed bool
+			)
+			if rule.keys[strings.ToLower(k)] {
+				nv, changed = rule.mask(fmt.Sprintf("%v", e)), true
+			} else {
+				nv, changed = rule.redactValue(e, depth+1)
+			}
+			if changed {
+				if out == nil {
+					out = make(map[string]interface{}, len(val))
+					for k2, e2 := range val {
+						out[k2] = e2
+					}
+				}
+				out[k] = nv
+			}
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	case map[string]string:
+		var out map[string]string
+		for k, e := range val {
+			nv := rule.redactText(e)
+			if rule.keys[strings.ToLower(k)] {
+				nv = rule.mask(e)
+			}
+			if nv != e {
+				if out == nil {
+					out = make(map[string]string, len(val))
+					for k2, e2 := range val {
+						out[k2] = e2
+					}
+				}
+				out[k] = nv
+			}
+		}
+		if out == nil {
+			return v, false
+		}
+		return out, true
+	case url.Values:
+		masked, changed := rule.redactValues(val)
+		return url.Values(masked), changed
+	case map[string][]string:
+		return rule.redactValues(val)
+	}
+	if rule.pattern == nil && rule.jsonKey == nil {
+		return v, false
+	}
+	if nv, changed, ok := rule.redactReflect(v, depth); ok {
+		return nv, changed
+	}
+	text := fmt.Sprintf("%+v", v)
+	if masked := rule.redactText(text); masked != text {
+		return masked, true
+	}
+	return v, false
+}
+
+// 结构体按导出字段名(有json tag时用tag名)匹配，切片和map按元素处理，需要脱敏时转为map[string]interface{}或[]interface{}
+// ok为false表示不是这几种类型
+func (rule *redactRule) redactReflect(v interface{}, depth int) (nv interface{}, changed bool, ok bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return v, false, true
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		t := rv.Type()
+		out := make(map[string]interface{}, rv.NumField())
+		for i := 0; i < rv.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+			name := sf.Name
+			if tag := strings.Split(sf.Tag.Get("json"), ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			fv := rv.Field(i).Interface()
+			if rule.keys[strings.ToLower(sf.Name)] || rule.keys[strings.ToLower(name)] {
+				out[name] = rule.mask(fmt.Sprintf("%v", fv))
+				changed = true
+				continue
+			}
+			var c bool
+			if out[name], c = rule.redactValue(fv, depth+1); c {
+				changed = true
+			}
+		}
+		// 没有需要脱敏的导出字段时按文本处理，未导出字段在文本格式中也会输出
+		if !changed {
+			return v, false, false
+		}
+		return out, true, true
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return v, false, false
+		}
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			var c bool
+			if out[i], c = rule.redactValue(rv.Index(i).Interface(), depth+1); c {
+				changed = true
+			}
+		}
+		if !changed {
+			return v, false, true
+		}
+		return out, true, true
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return v, false, false
+		}
+		out := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			k := iter.Key().String()
+			e := iter.Value().Interface()
+			if rule.keys[strings.ToLower(k)] {
+				out[k] = rule.mask(fmt.Sprintf("%v", e))
+				changed = true
+				continue
+			}
+			var c bool
+			if out[k], c = rule.redactValue(e, depth+1); c {
+				changed = true
+			}
+		}
+		if !changed {
+			return v, false, true
+		}
+		return out, true, true
+	}
+	return v, false, false
+}
+
+func (rule *redactRule) redactValues(val map[string][]string) (map[string][]string, bool) {
+	var out map[string][]string
+	for k, vs := range val {
+		var nvs []string
+		for i, e := range vs {
+			nv := rule.redactText(e)
+			if rule.keys[strings.ToLower(k)] {
+				nv = rule.mask(e)
+			}
+			if nv != e {
+				if nvs == nil {
+					nvs = append([]string(nil), vs...)
+				}
+				nvs[i] = nv
+			}
+		}
+		if nvs != nil {
+			if out == nil {
+				out = make(map[string][]string, len(val))
+				for k2, vs2 := range val {
+					out[k2] = vs2
+				}
+			}
+			out[k] = nvs
+		}
+	}
+	if out == nil {
+		return val, false
+	}
+	return out, true
+}
+
+// 参数列表中的字段名，如 HSET key password xxx
+func (rule *redactRule) isKey(v interface{}) bool {
+	if rule.keys == nil {
+		return false
+	}
+	switch k := v.(type) {
+	case string:
+		return rule.keys[strings.ToLower(k)]
+	case []byte:
+		return rule.keys[strings.ToLower(string(k))]
+	}
+	return false
+}
+
+// JSON、查询字符串中的同名参数和匹配正则的内容
+func (rule *redactRule) redactText(s string) string {
+	if s == "" {
+		return s
+	}
+	if rule.jsonKey != nil {
+		s = replaceSubmatch(rule.jsonKey, s, func(v string) string {
+			if len(v) >= 2 && v[0] == '"' {
+				return `"` + rule.mask(v[1:len(v)-1]) + `"`
+			}
+			return rule.mask(v)
+		})
+		s = replaceSubmatch(rule.formKey, s, rule.mask)
+	}
+	if rule.pattern != nil {
+		s = rule.pattern.ReplaceAllStringFunc(s, rule.mask)
+	}
+	return s
+}
+
+// 保留第一个分组，替换第二个分组
+func replaceSubmatch(re *regexp.Regexp, s string, mask func(string) string) string {
+	return re.ReplaceAllStringFunc(s, func(m string) string {
+		sm := re.FindStringSubmatch(m)
+		if len(sm) < 3 {
+			return m
+		}
+		return sm[1] + mask(sm[2])
+	})
+}
+
+func maskFull(string) string {
+	return redact_full_mask
+}
+
+// 保留首尾各约1/3(最多4个字符)，如 13812345678 -> 138*****678
+func maskPartial(s string) string {
+	runes := []rune(s)
+	keep := len(runes) / 3
+	if keep > 4 {
+		keep = 4
+	}
+	if keep == 0 {
+		return redact_full_mask
+	}
+	return string(runes[:keep]) + strings.Repeat("*", len(runes)-2*keep) + string(runes[len(runes)-keep:])
+}
+
+// 相同的值得到相同的结果，便于关联排查
+func maskHash(key []byte, s string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:8])
+}
@@ -0,0 +1,97 @@
+package log
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const DefaultLoggerName = "default"
+
+var (
+	loggers      = map[string]*Logger{}
+	loggersMutex sync.Mutex
+	// default Logger单独保存，包级函数读取时不加锁
+	defaultLogger atomic.Pointer[Logger]
+)
+
+// 按名称获取Logger，不存在时创建
+func Get(name string) *Logger {
+	loggersMutex.Lock()
+	defer loggersMutex.Unlock()
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+	l := NewLogger()
+	l.name = name
+	setLocked(name, l)
+	return l
+}
+
+// 包级函数均作用于default Logger
+func Default() *Logger {
+	if l := defaultLogger.Load(); l != nil {
+		return l
+	}
+	return Get(DefaultLoggerName)
+}
+
+// 需要持有loggersMutex，l为nil时移除
+func setLocked(name string, l *Logger) {
+	if l == nil {
+		delete(loggers, name)
+	} else {
+		loggers[name] = l
+	}
+	if name == DefaultLoggerName {
+		defaultLogger.Store(l)
+	}
+}
+
+// 替换指定名称的Logger并返回原Logger，原Logger不会被关闭，l为nil时移除
+func Set(name string, l *Logger) (old *Logger) {
+	loggersMutex.Lock()
+	defer loggersMutex.Unlock()
+	old = loggers[name]
+	if l != nil {
+		l.name = name
+	}
+	setLocked(name, l)
+	return
+}
+
+func lookup(name string) (*Logger, bool) {
+	loggersMutex.Lock()
+	defer loggersMutex.Unlock()
+	l, ok := loggers[name]
+	return l, ok
+}
+
+// 已创建的Logger名称
+func Names() []string {
+	loggersMutex.Lock()
+	defer loggersMutex.Unlock()
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 关闭并移除指定名称的Logger
+func CloseLogger(name string) {
+	loggersMutex.Lock()
+	l, ok := loggers[name]
+	setLocked(name, nil)
+	loggersMutex.Unlock()
+	if ok {
+		l.Close()
+	}
+}
+
+func CloseAll() {
+	for _, name := range Names() {
+		CloseLogger(name)
+	}
+}
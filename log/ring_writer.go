@@ -0,0 +1,270 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	ring_max_records_default = 10000
+	ring_query_limit_default = 100
+	ring_record_overhead     = 64
+)
+
+// 查询条件，零值表示不限制
+type RingQuery struct {
+	Level   int
+	DLTag   string
+	TraceId string
+	Since   time.Time
+	Until   time.Time
+	// 返回最近的Limit条
+	Limit int
+}
+
+// 在内存中保留最近的记录，用于排查线上问题
+type RingWriter struct {
+	mutex      sync.RWMutex
+	records    []*Record
+	sizes      []int
+	head       int
+	size       int
+	maxRecords int
+	maxBytes   int
+}
+
+func NewRingWriter() *RingWriter {
+	return &RingWriter{maxRecords: ring_max_records_default}
+}
+
+// 通过配置注册的RingWriter
+func (l *Logger) RingWriter() (*RingWriter, bool) {
+	l.workersMutex.RLock()
+	defer l.workersMutex.RUnlock()
+	for _, ww := range l.workers {
+		if w, ok := ww.writer.(*RingWriter); ok {
+			return w, true
+		}
+	}
+	return nil, false
+}
+
+// 最多保留的记录数，0表示不限制
+func (w *RingWriter) SetMaxRecords(n int) {
+	w.mutex.Lock()
+	w.maxRecords = n
+	w.mutex.Unlock()
+}
+
+// 最多占用的内存字节数(估算)，0表示不限制
+func (w *RingWriter) SetMaxBytes(n int) {
+	w.mutex.Lock()
+	w.maxBytes = n
+	w.mutex.Unlock()
+}
+
+func (w *RingWriter) Init() error {
+	if w.maxRecords <= 0 && w.maxBytes <= 0 {
+		return errors.New("ring writer needs max records or max bytes")
+	}
+	return nil
+}
+
+// Record写完后会被复用，保存副本
+// map、切片等值可能被调用方继续修改，转为JSON值的副本保存
+func (w *RingWriter) Write(r *Record) error {
+	cp := &Record{
+		t:     r.t,
+		time:  r.time,
+		code:  r.code,
+		fn:    r.fn,
+		info:  r.info,
+		level: r.level,
+	}
+	size := ring_record_overhead + len(r.time) + len(r.code) + len(r.fn) + len(r.info)
+	if len(r.fields) > 0 {
+		cp.fields = make([]Field, len(r.fields))
+		for i, f := range r.fields {
+			cp.fields[i] = snapshotField(f)
+			size += len(f.Key) + len(cp.fields[i].Text())
+		}
+	}
+
+	w.mutex.Lock()
+	w.records = append(w.records, cp)
+	w.sizes = append(w.sizes, size)
+	w.size += size
+	for w.len() > 0 && ((w.maxRecords > 0 && w.len() > w.maxRecords) || (w.maxBytes > 0 && w.size > w.maxBytes)) {
+		w.size -= w.sizes[w.head]
+		w.records[w.head] = nil
+		w.head++
+	}
+	// 前面空出的部分超过一半时整理
+	if w.head > len(w.records)/2 {
+		n := copy(w.records, w.records[w.head:])
+		copy(w.sizes, w.sizes[w.head:])
+		w.records = w.records[:n]
+		w.sizes = w.sizes[:n]
+		w.head = 0
+	}
+	w.mutex.Unlock()
+	return nil
+}
+
+func snapshotField(f Field) Field {
+	switch f.Type {
+	case StringType, IntType, FloatType, DurationType:
+		return f
+	case ErrorType:
+		if f.Value == nil {
+			return f
+		}
+		return Err(f.Key, errors.New(f.Text()))
+	}
+	data, err := json.Marshal(f.JSONValue())
+	if err != nil {
+		return String(f.Key, f.Text())
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&v); err != nil {
+		return String(f.Key, f.Text())
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		return Map(f.Key, m)
+	}
+	return Field{Key: f.Key, Type: AnyType, Value: v}
+}
+
+func (w *RingWriter) len() int {
+	return len(w.records) - w.head
+}
+
+// 按时间顺序返回满足条件的记录
+func (w *RingWriter) Query(q RingQuery) []*Record {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	var matched []*Record
+	for i := len(w.records) - 1; i >= w.head; i-- {
+		r := w.records[i]
+		if !q.match(r) {
+			continue
+		}
+		matched = append(matched, r)
+		if q.Limit > 0 && len(matched) >= q.Limit {
+			break
+		}
+	}
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	return matched
+}
+
+func (q RingQuery) match(r *Record) bool {
+	if r.level < q.Level {
+		return false
+	}
+	if !q.Since.IsZero() && r.t.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && r.t.After(q.Until) {
+		return false
+	}
+	if q.DLTag != "" {
+		if f, ok := r.Lookup(FieldDLTag); !ok || f.Text() != q.DLTag {
+			return false
+		}
+	}
+	if q.TraceId != "" {
+		if f, ok := r.Lookup(FieldTraceId); !ok || f.Text() != q.TraceId {
+			return false
+		}
+	}
+	return true
+}
+
+// 查询最近的记录
+// GET /?level=warn&dltag=_com_mysql_failure&traceid=xx&since=2006-01-02T15:04:05Z&until=1700000000000&limit=100&format=json
+// since/until为RFC3339时间或毫秒时间戳，format为json(默认)或text
+func (w *RingWriter) Handler() http.Handler {
+	return http.HandlerFunc(w.serveQuery)
+}
+
+func (w *RingWriter) serveQuery(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		rw.Header().Set("Allow", "GET")
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var (
+		params = req.URL.Query()
+		q      = RingQuery{DLTag: params.Get("dltag"), TraceId: params.Get("traceid"), Limit: ring_query_limit_default}
+		err    error
+	)
+	if v := params.Get("level"); v != "" {
+		if q.Level, err = ParseLevel(v); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if q.Since, err = parseQueryTime(params.Get("since")); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Until, err = parseQueryTime(params.Get("until")); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+			http.Error(rw, "Invalid limit ("+v+")", http.StatusBadRequest)
+			return
+		}
+	}
+
+	records := w.Query(q)
+	switch params.Get("format") {
+	case "", "json":
+		f := &JSONFormatter{}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write([]byte{'['})
+		for i, r := range records {
+			line := f.Format(r)
+			if i > 0 {
+				rw.Write([]byte{','})
+			}
+			rw.Write([]byte(line[:len(line)-1]))
+		}
+		rw.Write([]byte("]\n"))
+
+	case "text":
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, r := range records {
+			rw.Write([]byte(r.String()))
+		}
+
+	default:
+		http.Error(rw, "Invalid format ("+params.Get("format")+")", http.StatusBadRequest)
+	}
+}
+
+func parseQueryTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(0, ms*int64(time.Millisecond)), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return t, errors.New("Invalid time (" + v + ")")
+	}
+	return t, nil
+}
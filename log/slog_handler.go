@@ -0,0 +1,147 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// 将log/slog的日志写入Logger，属性按顺序转为Field，group以 group.key 的形式展开
+type SlogHandler struct {
+	logger  *Logger
+	attrs   []Field
+	group   string
+	context func(context.Context) []Field
+}
+
+// l为nil时使用default Logger
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{logger: l}
+}
+
+// 从context中取出的字段放在最前面，同名属性会覆盖其值
+func (h *SlogHandler) WithContextFields(fn func(context.Context) []Field) *SlogHandler {
+	c := *h
+	c.context = fn
+	return &c
+}
+
+func (h *SlogHandler) target() *Logger {
+	if h.logger != nil {
+		return h.logger
+	}
+	return Default()
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return slogLevel(level) >= h.target().Level()
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	l := h.target()
+	level := slogLevel(r.Level)
+	if level < l.Level() {
+		return nil
+	}
+
+	var fields []Field
+	if h.context != nil && ctx != nil {
+		fields = append(fields, h.context(ctx)...)
+	}
+	fields = mergeFields(fields, h.attrs)
+	attrs := make([]Field, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = appendSlogAttr(attrs, h.group, a)
+		return true
+	})
+	fields = mergeFields(fields, attrs)
+
+	var code, fn string
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		code = path.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+		if atomic.LoadInt32(&l.callerFunc) == 1 {
+			fn = path.Base(frame.Function)
+		}
+	}
+	l.deliver(level, code, fn, r.Message, fields)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	c := *h
+	fields := make([]Field, 0, len(attrs))
+	for _, a := range attrs {
+		fields = appendSlogAttr(fields, h.group, a)
+	}
+	c.attrs = mergeFields(append([]Field(nil), h.attrs...), fields)
+	return &c
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := *h
+	c.group = h.group + name + "."
+	return &c
+}
+
+// slog的Debug/Info/Warn/Error对应DEBUG/INFO/WARNING/ERROR，低于Debug为TRACE，Error+4及以上为FATAL
+func slogLevel(level slog.Level) int {
+	switch {
+	case level < slog.LevelDebug:
+		return TRACE
+	case level < slog.LevelInfo:
+		return DEBUG
+	case level < slog.LevelWarn:
+		return INFO
+	case level < slog.LevelError:
+		return WARNING
+	case level < slog.LevelError+4:
+		return ERROR
+	}
+	return FATAL
+}
+
+func appendSlogAttr(fields []Field, group string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		prefix := group
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendSlogAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+
+	key := group + a.Key
+	v := a.Value
+	switch v.Kind() {
+	case slog.KindString:
+		return append(fields, String(key, v.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, Any(key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float64(key, v.Float64()))
+	case slog.KindDuration:
+		return append(fields, Duration(key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, String(key, v.Time().Format(time.RFC3339Nano)))
+	}
+	return append(fields, Any(key, v.Any()))
+}
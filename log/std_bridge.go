@@ -0,0 +1,141 @@
+package log
+
+import (
+	"bytes"
+	stdlog "log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// 不完整的行超过该长度时直接输出
+const line_writer_max_buffer = 64 * 1024
+
+// 内部错误直接输出到stderr，不经过标准库log的默认Logger
+// 标准库log被重定向到Logger时，写入失败的错误不会再次进入日志管道
+var stderrLog = stdlog.New(os.Stderr, "", stdlog.LstdFlags)
+
+// 将写入的内容按行转为日志记录，不完整的行缓存到下次写入或Flush
+// 供只接受io.Writer的第三方库使用
+type LineWriter struct {
+	logger *Logger
+	level  int
+	fields []Field
+	// 标准库log模式：解析Lshortfile前缀作为代码位置，每次Write为一条记录，
+	// 多行内容(如panic堆栈)保留在同一条记录中，不按行拆分
+	stdCaller bool
+	mutex     sync.Mutex
+	buf       []byte
+}
+
+// l为nil时使用default Logger
+func NewLineWriter(l *Logger, level int, fields ...Field) *LineWriter {
+	return &LineWriter{logger: l, level: level, fields: fields}
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.buf = append(w.buf, p...)
+	// 标准库log每条日志只调用一次Write，多行内容保留为一条记录
+	if w.stdCaller && len(w.buf) > 0 && w.buf[len(w.buf)-1] == '\n' {
+		w.emit(w.buf[:len(w.buf)-1])
+		w.buf = w.buf[:0]
+		return len(p), nil
+	}
+	start := 0
+	for {
+		i := bytes.IndexByte(w.buf[start:], '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[start : start+i])
+		start += i + 1
+	}
+	if len(w.buf)-start > line_writer_max_buffer {
+		w.emit(w.buf[start:])
+		start = len(w.buf)
+	}
+	// 剩余的不完整行移到开头，复用底层数组
+	if start == len(w.buf) {
+		w.buf = w.buf[:0]
+	} else if start > 0 {
+		w.buf = w.buf[:copy(w.buf, w.buf[start:])]
+	}
+	return len(p), nil
+}
+
+// 输出缓存的不完整行
+func (w *LineWriter) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+	return nil
+}
+
+func (w *LineWriter) Close() error {
+	return w.Flush()
+}
+
+func (w *LineWriter) emit(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 {
+		return
+	}
+	l := w.logger
+	if l == nil {
+		l = Default()
+	}
+	if w.level < l.Level() {
+		return
+	}
+	var code string
+	if w.stdCaller {
+		code, line = splitStdCaller(line)
+	}
+	l.deliver(w.level, code, "", string(line), w.fields)
+}
+
+// 拆分 file.go:12: message
+func splitStdCaller(line []byte) (string, []byte) {
+	i := bytes.Index(line, []byte(": "))
+	if i < 0 {
+		return "", line
+	}
+	j := bytes.LastIndexByte(line[:i], ':')
+	if j <= 0 {
+		return "", line
+	}
+	if _, err := strconv.Atoi(string(line[j+1 : i])); err != nil {
+		return "", line
+	}
+	return string(line[:i]), line[i+2:]
+}
+
+// 写入Logger的标准库*log.Logger，供只接受*log.Logger的第三方库使用
+// 每次Print为一条记录，多行内容不拆分
+func NewStdLogger(l *Logger, level int, fields ...Field) *stdlog.Logger {
+	w := NewLineWriter(l, level, fields...)
+	w.stdCaller = true
+	return stdlog.New(w, "", stdlog.Lshortfile)
+}
+
+// 将标准库log的默认输出重定向到Logger，返回恢复原设置的函数
+// 每次Print为一条记录，多行内容不拆分
+func RedirectStdLog(l *Logger, level int, fields ...Field) func() {
+	out, flags, prefix := stdlog.Writer(), stdlog.Flags(), stdlog.Prefix()
+	w := NewLineWriter(l, level, fields...)
+	w.stdCaller = true
+	stdlog.SetOutput(w)
+	stdlog.SetFlags(stdlog.Lshortfile)
+	stdlog.SetPrefix("")
+	return func() {
+		stdlog.SetOutput(out)
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+		w.Flush()
+	}
+}
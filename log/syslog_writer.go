@@ -0,0 +1,253 @@
+package log
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// syslog severity，按 TRACE..FATAL 的顺序
+var syslogSeverity = [...]int{7, 7, 6, 4, 3, 2}
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// 本地syslog的unix socket
+var syslogLocalAddrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+const (
+	syslogDialTimeout = 3 * time.Second
+	// tcp未发送的帧达到该字节数时立即发送
+	syslog_batch_size = 8192
+	// tcp未发送的帧的上限，超过后丢弃最早的
+	syslog_max_pending = 1 << 20
+)
+
+func ParseFacility(name string) (int, error) {
+	if name == "" {
+		return syslogFacilities["user"], nil
+	}
+	if f, ok := syslogFacilities[strings.ToLower(name)]; ok {
+		return f, nil
+	}
+	return 0, errors.New("Invalid syslog facility (" + name + ")")
+}
+
+// 按RFC 5424格式输出到syslog，tcp使用octet counting分帧
+type SyslogWriter struct {
+	logLevelFloor int
+	logLevelCeil  int
+	network       string
+	addr          string
+	facility      int
+	appName       string
+	hostname      string
+	procId        string
+	formatter     Formatter
+	conn          net.Conn
+	// tcp未完整发送的帧，连接断开后在新连接上从帧开头重发
+	frames      []string
+	pendingSize int
+}
+
+func NewSyslogWriter() *SyslogWriter {
+	return &SyslogWriter{
+		logLevelCeil: FATAL,
+		facility:     syslogFacilities["user"],
+	}
+}
+
+// network: unixgram、udp、tcp，为空时连接本地syslog
+func (w *SyslogWriter) SetAddr(network, addr string) {
+	w.network = network
+	w.addr = addr
+}
+
+func (w *SyslogWriter) SetFacility(facility int) {
+	w.facility = facility
+}
+
+func (w *SyslogWriter) SetAppName(name string) {
+	w.appName = name
+}
+
+func (w *SyslogWriter) SetLogLevelFloor(floor int) {
+	w.logLevelFloor = floor
+}
+
+func (w *SyslogWriter) SetLogLevelCeil(ceil int) {
+	w.logLevelCeil = ceil
+}
+
+// MSG部分的格式，默认为 code dltag||info||k=v
+func (w *SyslogWriter) SetFormatter(f Formatter) {
+	w.formatter = f
+}
+
+func (w *SyslogWriter) Init() error {
+	switch w.network {
+	case "", "unixgram", "udp", "tcp":
+	default:
+		return errors.New("Invalid syslog network (" + w.network + ")")
+	}
+	if w.network != "" && w.addr == "" {
+		return errors.New("syslog addr is empty")
+	}
+	if w.appName == "" {
+		w.appName = filepath.Base(os.Args[0])
+	}
+	if w.hostname == "" {
+		if w.hostname, _ = os.Hostname(); w.hostname == "" {
+			w.hostname = "-"
+		}
+	}
+	w.procId = strconv.Itoa(os.Getpid())
+	// 收集端暂时不可用不影响启动，Write时重连
+	if err := w.connect(); err != nil {
+		stderrLog.Println(err)
+	}
+	return nil
+}
+
+func (w *SyslogWriter) connect() (err error) {
+	w.close()
+	var conn net.Conn
+	if w.network == "" {
+		for _, addr := range syslogLocalAddrs {
+			if conn, err = net.DialTimeout("unixgram", addr, syslogDialTimeout); err == nil {
+				break
+			}
+		}
+	} else {
+		conn, err = net.DialTimeout(w.network, w.addr, syslogDialTimeout)
+	}
+	if err != nil {
+		return
+	}
+	w.conn = conn
+	return
+}
+
+func (w *SyslogWriter) close() {
+	if w.conn != nil {
+		w.conn.Close()
+	}
+	w.conn = nil
+}
+
+func (w *SyslogWriter) Write(r *Record) error {
+	if r.level < w.logLevelFloor || r.level > w.logLevelCeil {
+		return nil
+	}
+	msg := w.format(r)
+	if w.network == "tcp" {
+		frame := strconv.Itoa(len(msg)) + " " + msg
+		w.frames = append(w.frames, frame)
+		w.pendingSize += len(frame)
+		if w.pendingSize >= syslog_batch_size {
+			return w.Flush()
+		}
+		return nil
+	}
+	if w.conn != nil {
+		if err := w.send(msg); err == nil {
+			return nil
+		}
+	}
+	// 连接断开后重连并重发一次
+	if err := w.connect(); err != nil {
+		return err
+	}
+	if err := w.send(msg); err != nil {
+		w.close()
+		return err
+	}
+	return nil
+}
+
+func (w *SyslogWriter) send(msg string) error {
+	_, err := w.conn.Write([]byte(msg))
+	return err
+}
+
+// 发送tcp未发送的帧，仍失败的帧保留到下次Flush
+func (w *SyslogWriter) Flush() error {
+	if len(w.frames) == 0 {
+		return nil
+	}
+	if w.conn != nil {
+		if err := w.sendFrames(); err == nil {
+			return nil
+		}
+	}
+	// 连接断开后重连，从未完整发送的帧开始重发一次
+	err := w.connect()
+	if err == nil {
+		err = w.sendFrames()
+	}
+	if err != nil {
+		w.close()
+		w.trimFrames()
+	}
+	return err
+}
+
+// 只移除完整发送的帧
+func (w *SyslogWriter) sendFrames() error {
+	n, err := w.conn.Write([]byte(strings.Join(w.frames, "")))
+	i := 0
+	for ; i < len(w.frames) && n >= len(w.frames[i]); i++ {
+		n -= len(w.frames[i])
+		w.pendingSize -= len(w.frames[i])
+	}
+	w.frames = w.frames[i:]
+	return err
+}
+
+func (w *SyslogWriter) trimFrames() {
+	for w.pendingSize > syslog_max_pending {
+		w.pendingSize -= len(w.frames[0])
+		w.frames = w.frames[1:]
+	}
+}
+
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID - MSG
+func (w *SyslogWriter) format(r *Record) string {
+	msgId := "-"
+	if f, ok := r.Lookup(FieldDLTag); ok {
+		msgId = syslogHeaderValue(f.Text(), 32)
+	}
+	var msg string
+	if w.formatter != nil {
+		msg = strings.TrimRight(w.formatter.Format(r), "\n")
+	} else {
+		msg = r.caller() + " " + r.body()
+	}
+	return "<" + strconv.Itoa(w.facility*8+syslogSeverity[r.level]) + ">1 " +
+		r.t.Format("2006-01-02T15:04:05.000000Z07:00") + " " +
+		syslogHeaderValue(w.hostname, 255) + " " +
+		syslogHeaderValue(w.appName, 48) + " " +
+		w.procId + " " + msgId + " - " + msg
+}
+
+// 头部字段只允许可打印ASCII字符且有长度限制
+func syslogHeaderValue(s string, max int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < max; i++ {
+		if s[i] > 32 && s[i] < 127 {
+			b = append(b, s[i])
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
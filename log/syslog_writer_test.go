@@ -0,0 +1,219 @@
+package log_test
+
+import (
+	"bufio"
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID - MSG
+var syslogFrameRegexp = regexp.MustCompile(`(?s)^<(\d+)>1 (\S+) (\S+) (\S+) (\d+) (\S+) - (.*)$`)
+
+// 按octet counting读取帧的tcp syslog收集端
+type syslogServer struct {
+	ln     net.Listener
+	frames chan string
+	mutex  sync.Mutex
+	conns  []net.Conn
+}
+
+func newSyslogServer(t *testing.T, addr string) *syslogServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &syslogServer{ln: ln, frames: make(chan string, 100)}
+	go s.serve()
+	t.Cleanup(s.close)
+	return s
+}
+
+func (s *syslogServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.mutex.Unlock()
+		go s.read(conn)
+	}
+}
+
+func (s *syslogServer) read(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+		if err != nil {
+			s.frames <- "bad frame length: " + size
+			return
+		}
+		frame := make([]byte, n)
+		if _, err = io.ReadFull(r, frame); err != nil {
+			return
+		}
+		s.frames <- string(frame)
+	}
+}
+
+// 断开已有连接，监听继续
+func (s *syslogServer) dropConns() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *syslogServer) close() {
+	s.ln.Close()
+	s.dropConns()
+}
+
+func (s *syslogServer) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case f := <-s.frames:
+		return f
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog frame received")
+	}
+	return ""
+}
+
+func newSyslogLogger(t *testing.T, addr string) (*log.Logger, *logtest.Recorder) {
+	t.Helper()
+	l, rec := logtest.NewLogger()
+	w := log.NewSyslogWriter()
+	w.SetAddr("tcp", addr)
+	w.SetAppName("svc")
+	facility, err := log.ParseFacility("local0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetFacility(facility)
+	l.Register(w)
+	t.Cleanup(l.Close)
+	return l, rec
+}
+
+func TestSyslogWriterRFC5424Framing(t *testing.T) {
+	s := newSyslogServer(t, "127.0.0.1:0")
+	l, rec := newSyslogLogger(t, s.ln.Addr().String())
+
+	l.Log(log.ERROR, "query failed", log.String(log.FieldDLTag, "_com_mysql_failure"), log.Int("rows", 0))
+	l.Log(log.INFO, "line1\nline2")
+
+	// local0=16，ERROR对应severity 3，INFO对应6
+	wantPri := []int{16*8 + 3, 16*8 + 6}
+	wantMsgId := []string{"_com_mysql_failure", "-"}
+	entries := rec.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(entries))
+	}
+	for i, e := range entries {
+		frame := s.next(t)
+		m := syslogFrameRegexp.FindStringSubmatch(frame)
+		if m == nil {
+			t.Fatalf("frame %q is not RFC 5424", frame)
+		}
+		if m[1] != strconv.Itoa(wantPri[i]) {
+			t.Errorf("PRI = %s, want %d", m[1], wantPri[i])
+		}
+		if _, err := time.Parse(time.RFC3339Nano, m[2]); err != nil {
+			t.Errorf("TIMESTAMP %q: %v", m[2], err)
+		}
+		if m[4] != "svc" || m[5] != strconv.Itoa(os.Getpid()) || m[6] != wantMsgId[i] {
+			t.Errorf("header = %v", m[3:7])
+		}
+		if !strings.HasPrefix(m[7], e.Code+" ") || !strings.Contains(m[7], e.Message) {
+			t.Errorf("MSG %q does not match record %s", m[7], e)
+		}
+	}
+}
+
+func TestSyslogWriterReconnect(t *testing.T) {
+	s := newSyslogServer(t, "127.0.0.1:0")
+	l, _ := newSyslogLogger(t, s.ln.Addr().String())
+
+	l.Info("before")
+	if f := s.next(t); !strings.Contains(f, "before") {
+		t.Fatalf("got %q", f)
+	}
+
+	// 收集端断开连接后，第一次写入可能仍然成功，之后写入失败的帧在新连接上重发
+	s.dropConns()
+	l.Info("maybe lost")
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		l.Info("after-%d", i)
+	}
+	want := 0
+	for want < 5 {
+		f := s.next(t)
+		if strings.Contains(f, "maybe lost") {
+			continue
+		}
+		if !strings.HasSuffix(f, "after-"+strconv.Itoa(want)) {
+			t.Fatalf("got %q, want after-%d", f, want)
+		}
+		want++
+	}
+}
+
+func TestSyslogWriterBatchedFrames(t *testing.T) {
+	s := newSyslogServer(t, "127.0.0.1:0")
+	l := log.NewLogger()
+	w := log.NewSyslogWriter()
+	w.SetAddr("tcp", s.ln.Addr().String())
+	l.Register(w)
+
+	// 未达到批量大小的帧在Close时发送
+	for i := 0; i < 3; i++ {
+		l.Info("batched-%d", i)
+	}
+	l.Close()
+	for i := 0; i < 3; i++ {
+		if f := s.next(t); !strings.HasSuffix(f, "batched-"+strconv.Itoa(i)) {
+			t.Fatalf("got %q, want batched-%d", f, i)
+		}
+	}
+}
+
+func TestSyslogWriterCollectorDownAtStartup(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	// 收集端不可用时Register不能panic，发送失败的帧保留到收集端恢复
+	l, rec := newSyslogLogger(t, addr)
+	l.Info("early")
+
+	s := newSyslogServer(t, addr)
+	l.Info("delivered")
+	for _, want := range []string{"early", "delivered"} {
+		if f := s.next(t); !strings.HasSuffix(f, " "+want) {
+			t.Fatalf("got %q, want %s", f, want)
+		}
+	}
+	rec.ExpectCount(t, 2, logtest.Level(log.INFO))
+}
@@ -0,0 +1,86 @@
+package log
+
+import (
+	"strconv"
+	"time"
+)
+
+// 可用于SetLayout和配置Layout的特殊格式
+const (
+	LayoutRFC3339Nano = "rfc3339nano"
+	LayoutEpochMillis = "epoch_millis"
+)
+
+type timeFormat struct {
+	layout string
+	loc    *time.Location
+	// 精度小于秒的格式不能按秒缓存
+	subSecond bool
+}
+
+// 同一秒内复用格式化结果
+type timeCache struct {
+	tf  *timeFormat
+	sec int64
+	str string
+}
+
+func newTimeFormat(layout string, loc *time.Location) *timeFormat {
+	tf := &timeFormat{layout: layout, loc: loc}
+	switch layout {
+	case LayoutRFC3339Nano, LayoutEpochMillis:
+		tf.subSecond = true
+	default:
+		t := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+		tf.subSecond = t.Format(layout) != t.Add(123456789).Format(layout)
+	}
+	return tf
+}
+
+func (tf *timeFormat) format(t time.Time) string {
+	switch tf.layout {
+	case LayoutEpochMillis:
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+
+	case LayoutRFC3339Nano:
+		return t.In(tf.loc).Format(time.RFC3339Nano)
+	}
+	return t.In(tf.loc).Format(tf.layout)
+}
+
+func (l *Logger) SetLayout(layout string) {
+	l.timeMutex.Lock()
+	tf := l.timeFormat.Load().(*timeFormat)
+	l.timeFormat.Store(newTimeFormat(layout, tf.loc))
+	l.timeMutex.Unlock()
+}
+
+func (l *Logger) Layout() string {
+	return l.timeFormat.Load().(*timeFormat).layout
+}
+
+// 时区名称无效时保持原时区
+func (l *Logger) SetLoadLocation(loadLocation string) {
+	loc, err := time.LoadLocation(loadLocation)
+	if err != nil {
+		return
+	}
+	l.timeMutex.Lock()
+	tf := l.timeFormat.Load().(*timeFormat)
+	l.timeFormat.Store(newTimeFormat(tf.layout, loc))
+	l.timeMutex.Unlock()
+}
+
+func (l *Logger) formatTime(t time.Time) string {
+	tf := l.timeFormat.Load().(*timeFormat)
+	if tf.subSecond {
+		return tf.format(t)
+	}
+	sec := t.Unix()
+	if c, ok := l.timeCache.Load().(*timeCache); ok && c.tf == tf && c.sec == sec {
+		return c.str
+	}
+	str := tf.format(t)
+	l.timeCache.Store(&timeCache{tf: tf, sec: sec, str: str})
+	return str
+}
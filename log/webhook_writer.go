@@ -0,0 +1,325 @@
+package log
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	WebhookDingTalk = "dingtalk"
+	WebhookFeishu   = "feishu"
+	WebhookSlack    = "slack"
+	WebhookGeneric  = "generic"
+)
+
+const (
+	webhook_window_default  = time.Minute
+	webhook_rate_default    = 10
+	webhook_timeout_default = 5 * time.Second
+)
+
+// generic模板可用的数据
+type WebhookMessage struct {
+	Level   string `json:"level"`
+	Time    string `json:"time"`
+	Caller  string `json:"caller"`
+	DLTag   string `json:"dltag"`
+	Message string `json:"message"`
+	Text    string `json:"text"`
+	// 窗口内相同消息的次数，首条为1
+	Count int `json:"count"`
+	// 因限流未发送的消息数
+	Suppressed int `json:"suppressed"`
+}
+
+type webhookGroup struct {
+	msg   WebhookMessage
+	start time.Time
+	count int
+}
+
+type webhookRate struct {
+	start      time.Time
+	sent       int
+	suppressed int
+}
+
+// 将告警级别的记录推送到钉钉、飞书、Slack或自定义webhook。
+// 窗口内相同的消息只推送首条，窗口结束时推送重复次数；每个dltag每分钟的推送数有上限
+type WebhookWriter struct {
+	logLevelFloor int
+	logLevelCeil  int
+	kind          string
+	url           string
+	secret        string
+	tmpl          *template.Template
+	window        time.Duration
+	ratePerMinute int
+	client        *http.Client
+	groups        map[string]*webhookGroup
+	rates         map[string]*webhookRate
+}
+
+func NewWebhookWriter() *WebhookWriter {
+	return &WebhookWriter{
+		logLevelFloor: ERROR,
+		logLevelCeil:  FATAL,
+		window:        webhook_window_default,
+		ratePerMinute: webhook_rate_default,
+		client:        &http.Client{Timeout: webhook_timeout_default},
+		groups:        map[string]*webhookGroup{},
+		rates:         map[string]*webhookRate{},
+	}
+}
+
+// kind: dingtalk、feishu、slack、generic
+func (w *WebhookWriter) SetWebhook(kind, url string) {
+	w.kind = kind
+	w.url = url
+}
+
+// 钉钉、飞书机器人的加签密钥
+func (w *WebhookWriter) SetSecret(secret string) {
+	w.secret = secret
+}
+
+// generic的请求体模板，可用json函数转义，如 {"text":{{json .Text}}}
+func (w *WebhookWriter) SetTemplate(text string) (err error) {
+	if text == "" {
+		w.tmpl = nil
+		return
+	}
+	w.tmpl, err = template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	return
+}
+
+func (w *WebhookWriter) SetLogLevelFloor(floor int) {
+	w.logLevelFloor = floor
+}
+
+func (w *WebhookWriter) SetLogLevelCeil(ceil int) {
+	w.logLevelCeil = ceil
+}
+
+// 相同消息的聚合窗口
+func (w *WebhookWriter) SetWindow(window time.Duration) {
+	if window > 0 {
+		w.window = window
+	}
+}
+
+// 每个dltag每分钟最多推送的消息数
+func (w *WebhookWriter) SetRateLimit(perMinute int) {
+	if perMinute > 0 {
+		w.ratePerMinute = perMinute
+	}
+}
+
+func (w *WebhookWriter) Init() error {
+	switch w.kind {
+	case WebhookDingTalk, WebhookFeishu, WebhookSlack, WebhookGeneric:
+	default:
+		return errors.New("Invalid webhook kind (" + w.kind + ")")
+	}
+	if w.url == "" {
+		return errors.New("webhook url is empty")
+	}
+	return nil
+}
+
+func (w *WebhookWriter) Write(r *Record) error {
+	if r.level < w.logLevelFloor || r.level > w.logLevelCeil {
+		return nil
+	}
+	msg := WebhookMessage{
+		Level:   LEVEL_FLAGS[r.level],
+		Time:    r.time,
+		Caller:  r.code,
+		Message: r.info,
+		Count:   1,
+	}
+	if f, ok := r.Lookup(FieldDLTag); ok {
+		msg.DLTag = f.Text()
+	}
+	msg.Text = "[" + msg.Level + "][" + msg.Time + "][" + msg.Caller + "]\n" + r.body()
+
+	// 按级别、位置、dltag、内容和字段聚合，traceid等每个请求不同的字段不参与
+	key := msg.Level + "|" + msg.Caller + "|" + msg.DLTag + "|" + msg.Message + "|" + webhookFieldsKey(r.fields)
+	if g, ok := w.groups[key]; ok {
+		g.count++
+		return nil
+	}
+	w.groups[key] = &webhookGroup{msg: msg, start: time.Now()}
+	return w.push(msg)
+}
+
+// 耗时每次都不同，也不参与聚合
+var webhookVolatileKeys = map[string]bool{
+	FieldDLTag: true, FieldTraceId: true, FieldSpanId: true, FieldCSpanId: true, "proc_time": true,
+}
+
+func webhookFieldsKey(fields []Field) string {
+	h := fnv.New64a()
+	for _, f := range fields {
+		if webhookVolatileKeys[f.Key] {
+			continue
+		}
+		h.Write([]byte(f.Key))
+		h.Write([]byte{'='})
+		h.Write([]byte(f.Text()))
+		h.Write([]byte{0})
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// 窗口结束时推送重复次数
+func (w *WebhookWriter) Flush() error {
+	return w.flushGroups(false)
+}
+
+func (w *WebhookWriter) Close() error {
+	return w.flushGroups(true)
+}
+
+func (w *WebhookWriter) flushGroups(all bool) (err error) {
+	now := time.Now()
+	// 已过期的限流计数，有未报告的限流数时保留到该dltag的下一条推送
+	for tag, rate := range w.rates {
+		if rate.suppressed == 0 && now.Sub(rate.start) >= time.Minute {
+			delete(w.rates, tag)
+		}
+	}
+	for key, g := range w.groups {
+		if !all && now.Sub(g.start) < w.window {
+			continue
+		}
+		delete(w.groups, key)
+		if g.count == 0 {
+			continue
+		}
+		msg := g.msg
+		msg.Count = g.count + 1
+		msg.Text += "\n(repeated " + strconv.Itoa(g.count) + " times in " + w.window.String() + ")"
+		if e := w.push(msg); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+// 按dltag限流
+func (w *WebhookWriter) push(msg WebhookMessage) error {
+	now := time.Now()
+	rate, ok := w.rates[msg.DLTag]
+	if !ok || now.Sub(rate.start) >= time.Minute {
+		if ok && rate.suppressed > 0 {
+			msg.Suppressed = rate.suppressed
+		}
+		rate = &webhookRate{start: now}
+		w.rates[msg.DLTag] = rate
+	}
+	if rate.sent >= w.ratePerMinute {
+		rate.suppressed++
+		return nil
+	}
+	rate.sent++
+	if msg.Suppressed > 0 {
+		msg.Text += "\n(" + strconv.Itoa(msg.Suppressed) + " alerts suppressed by rate limit)"
+	}
+	return w.post(msg)
+}
+
+func (w *WebhookWriter) post(msg WebhookMessage) error {
+	body, err := w.payload(msg)
+	if err != nil {
+		return err
+	}
+	u := w.url
+	if w.kind == WebhookDingTalk && w.secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		sign := webhookSign(w.secret, ts+"\n"+w.secret)
+		sep := "?"
+		if strings.Contains(u, "?") {
+			sep = "&"
+		}
+		u += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(sign)
+	}
+	resp, err := w.client.Post(u, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return errors.New("webhook: " + resp.Status + " " + httpErrorBody(data))
+	}
+	// 钉钉、飞书出错时仍返回200
+	var result struct {
+		ErrCode int `json:"errcode"`
+		Code    int `json:"code"`
+	}
+	if json.Unmarshal(data, &result) == nil && (result.ErrCode != 0 || result.Code != 0) {
+		return errors.New("webhook: " + httpErrorBody(data))
+	}
+	return nil
+}
+
+func (w *WebhookWriter) payload(msg WebhookMessage) ([]byte, error) {
+	var v interface{}
+	switch w.kind {
+	case WebhookDingTalk:
+		v = map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": msg.Text},
+		}
+
+	case WebhookFeishu:
+		m := map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": msg.Text},
+		}
+		if w.secret != "" {
+			ts := strconv.FormatInt(time.Now().Unix(), 10)
+			m["timestamp"] = ts
+			m["sign"] = webhookSign(ts+"\n"+w.secret, "")
+		}
+		v = m
+
+	case WebhookSlack:
+		v = map[string]string{"text": msg.Text}
+
+	default:
+		if w.tmpl != nil {
+			buf := &bytes.Buffer{}
+			if err := w.tmpl.Execute(buf, msg); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+		v = msg
+	}
+	return json.Marshal(v)
+}
+
+func webhookSign(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
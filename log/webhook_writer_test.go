@@ -0,0 +1,46 @@
+package log_test
+
+import (
+	"encoding/json"
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookWriterRepeatCount(t *testing.T) {
+	url, requests := newHTTPCollector(t, "")
+	w := log.NewWebhookWriter()
+	w.SetWebhook(log.WebhookGeneric, url)
+	if err := w.SetTemplate(`{"count":{{.Count}},"text":{{json .Text}}}`); err != nil {
+		t.Fatal(err)
+	}
+	l, rec := logtest.NewLogger()
+	l.Register(w)
+	// traceid不同的相同告警在窗口内聚合
+	for _, traceId := range []string{"t1", "t2", "t3"} {
+		l.Log(log.ERROR, "query failed", log.String(log.FieldDLTag, "_com_mysql_failure"), log.String(log.FieldTraceId, traceId))
+	}
+	l.Close()
+	rec.ExpectCount(t, 3, logtest.DLTag("_com_mysql_failure"))
+
+	// 首条立即推送，窗口结束时推送包含首条在内的总次数
+	for i, want := range []int{1, 3} {
+		var msg struct {
+			Count int    `json:"count"`
+			Text  string `json:"text"`
+		}
+		req := receiveRequest(t, requests)
+		if err := json.Unmarshal(req.body, &msg); err != nil {
+			t.Fatalf("%v: %s", err, req.body)
+		}
+		if msg.Count != want || !strings.Contains(msg.Text, "query failed") {
+			t.Errorf("push %d = %+v, want count %d", i, msg, want)
+		}
+	}
+	select {
+	case req := <-requests:
+		t.Errorf("unexpected push %s", req.body)
+	default:
+	}
+}
@@ -0,0 +1,191 @@
+package log
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const writer_queue_size_default = 1024
+
+// 单个Writer的队列统计
+type WriterStat struct {
+	Writer   string `json:"writer"`
+	QueueLen int    `json:"queue_len"`
+	QueueCap int    `json:"queue_cap"`
+	Written  uint64 `json:"written"`
+	Dropped  uint64 `json:"dropped"`
+	Errors   uint64 `json:"errors"`
+}
+
+// 每个Writer独立的队列和goroutine，慢的Writer不会阻塞其他Writer
+type writerWorker struct {
+	written uint64
+	dropped uint64
+	errors  uint64
+	writer  Writer
+	queue   chan *Record
+	done    chan bool
+	release func(*Record)
+	// 队列写满丢弃记录时调用，计入Logger的丢弃统计
+	drop func(*Record)
+	sync bool
+}
+
+func newWriterWorker(w Writer, size int, release func(*Record), drop func(*Record)) *writerWorker {
+	ww := &writerWorker{
+		writer:  w,
+		queue:   make(chan *Record, size),
+		done:    make(chan bool, 1),
+		release: release,
+		drop:    drop,
+	}
+	go ww.run()
+	return ww
+}
+
+// 同步模式没有队列和goroutine，由调用方串行写入
+func newSyncWriterWorker(w Writer, release func(*Record)) *writerWorker {
+	return &writerWorker{
+		writer:  w,
+		release: release,
+		sync:    true,
+	}
+}
+
+// 队列已满时按Logger的overflow policy处理
+func (ww *writerWorker) deliver(r *Record, policy int, timeout time.Duration) {
+	if ww.sync {
+		ww.write(r)
+		ww.flush()
+		return
+	}
+	switch policy {
+	case OverflowDropNewest:
+		select {
+		case ww.queue <- r:
+		default:
+			ww.dropRecord(r)
+		}
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case ww.queue <- r:
+				return
+			default:
+			}
+			select {
+			case old := <-ww.queue:
+				ww.dropRecord(old)
+			default:
+			}
+		}
+
+	case OverflowBlockTimeout:
+		select {
+		case ww.queue <- r:
+			return
+		default:
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case ww.queue <- r:
+		case <-timer.C:
+			ww.dropRecord(r)
+		}
+		timer.Stop()
+
+	default:
+		ww.queue <- r
+	}
+}
+
+func (ww *writerWorker) dropRecord(r *Record) {
+	atomic.AddUint64(&ww.dropped, 1)
+	ww.drop(r)
+	ww.release(r)
+}
+
+func (ww *writerWorker) write(r *Record) {
+	if err := ww.writer.Write(r); err != nil {
+		atomic.AddUint64(&ww.errors, 1)
+		stderrLog.Println(err)
+	} else {
+		atomic.AddUint64(&ww.written, 1)
+	}
+	ww.release(r)
+}
+
+func (ww *writerWorker) flush() {
+	if f, ok := ww.writer.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			stderrLog.Println(err)
+		}
+	}
+}
+
+func (ww *writerWorker) closeWriter() {
+	if c, ok := ww.writer.(Closer); ok {
+		if err := c.Close(); err != nil {
+			stderrLog.Println(err)
+		}
+	}
+}
+
+func (ww *writerWorker) rotate() {
+	if r, ok := ww.writer.(Rotater); ok {
+		if err := r.Rotate(); err != nil {
+			stderrLog.Println(err)
+		}
+	}
+}
+
+func (ww *writerWorker) run() {
+	flushTimer := time.NewTimer(time.Millisecond * 500)
+	rotateTimer := time.NewTimer(time.Second * 10)
+	defer flushTimer.Stop()
+	defer rotateTimer.Stop()
+
+	for {
+		select {
+		case r, ok := <-ww.queue:
+			if !ok {
+				ww.flush()
+				ww.closeWriter()
+				ww.done <- true
+				return
+			}
+			ww.write(r)
+
+		case <-flushTimer.C:
+			ww.flush()
+			flushTimer.Reset(time.Millisecond * 1000)
+
+		case <-rotateTimer.C:
+			ww.rotate()
+			rotateTimer.Reset(time.Second * 10)
+		}
+	}
+}
+
+// 关闭队列并等待剩余记录写完
+func (ww *writerWorker) close() {
+	if ww.sync {
+		ww.closeWriter()
+		return
+	}
+	close(ww.queue)
+	<-ww.done
+}
+
+func (ww *writerWorker) stat() WriterStat {
+	return WriterStat{
+		Writer:   fmt.Sprintf("%T", ww.writer),
+		QueueLen: len(ww.queue),
+		QueueCap: cap(ww.queue),
+		Written:  atomic.LoadUint64(&ww.written),
+		Dropped:  atomic.LoadUint64(&ww.dropped),
+		Errors:   atomic.LoadUint64(&ww.errors),
+	}
+}
@@ -0,0 +1,81 @@
+package log_test
+
+import (
+	"github.com/xiaka53/DeployAndLog/log"
+	"github.com/xiaka53/DeployAndLog/logtest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 每条记录耗时1ms的Writer
+type slowWriter struct {
+	written int64
+}
+
+func (w *slowWriter) Init() error {
+	return nil
+}
+
+func (w *slowWriter) Write(r *log.Record) error {
+	time.Sleep(time.Millisecond)
+	if r.Level() == log.INFO {
+		atomic.AddInt64(&w.written, 1)
+	}
+	return nil
+}
+
+// 慢Writer的队列长度为2，Recorder的队列足够大
+func runSlowWriter(policy int, timeout time.Duration) (*log.Logger, *slowWriter, *logtest.Recorder) {
+	l := log.NewLogger()
+	l.SetOverflowPolicy(policy, timeout)
+	rec := logtest.NewRecorder()
+	l.Register(rec)
+	l.SetWriterQueueSize(2)
+	w := &slowWriter{}
+	l.Register(w)
+	for i := 0; i < 200; i++ {
+		l.Info("burst %d", i)
+	}
+	l.Close()
+	return l, w, rec
+}
+
+func TestWriterQueueBlock(t *testing.T) {
+	for _, policy := range []int{log.OverflowBlock, log.OverflowBlockTimeout} {
+		l, w, _ := runSlowWriter(policy, time.Second)
+		if w.written != 200 {
+			t.Errorf("policy %d: slow writer got %d of 200 records", policy, w.written)
+		}
+		if n := l.Dropped()["INFO"]; n != 0 {
+			t.Errorf("policy %d: dropped %d records", policy, n)
+		}
+		for _, s := range l.Stats() {
+			if s.Dropped != 0 {
+				t.Errorf("policy %d: %s dropped %d records", policy, s.Writer, s.Dropped)
+			}
+		}
+	}
+}
+
+func TestWriterQueueDropCounted(t *testing.T) {
+	for _, policy := range []int{log.OverflowDropNewest, log.OverflowDropOldest, log.OverflowBlockTimeout} {
+		l, w, rec := runSlowWriter(policy, time.Microsecond)
+		dropped := l.Dropped()["INFO"]
+		if dropped == 0 || int64(dropped)+w.written != 200 {
+			t.Errorf("policy %d: written %d, dropped %d, want 200 in total", policy, w.written, dropped)
+		}
+		// Writer队列的丢弃同样输出统计，drop_oldest在最后一次统计之后还可能挤掉队列中的记录
+		var reported int64
+		for _, e := range rec.Find(logtest.Level(log.WARNING), logtest.MessageContains("records dropped")) {
+			if f, ok := e.Field("info"); ok {
+				n, _ := strconv.ParseInt(f.Text(), 10, 64)
+				reported += n
+			}
+		}
+		if reported == 0 || reported > int64(dropped) {
+			t.Errorf("policy %d: warnings report %d dropped, want up to %d", policy, reported, dropped)
+		}
+	}
+}
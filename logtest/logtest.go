@@ -0,0 +1,256 @@
+package logtest
+
+import (
+	"fmt"
+	"github.com/xiaka53/DeployAndLog/log"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// testing.T、testing.B都满足该接口
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// 捕获到的一条日志，Record会被复用，这里保存副本
+type Entry struct {
+	Level   int
+	Time    time.Time
+	Code    string
+	Func    string
+	Message string
+	Fields  []log.Field
+}
+
+func (e Entry) Field(key string) (log.Field, bool) {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return log.Field{}, false
+}
+
+func (e Entry) DLTag() string {
+	f, _ := e.Field(log.FieldDLTag)
+	return fieldText(f)
+}
+
+func (e Entry) TraceId() string {
+	f, _ := e.Field(log.FieldTraceId)
+	return fieldText(f)
+}
+
+func (e Entry) String() string {
+	parts := []string{"[" + log.LEVEL_FLAGS[e.Level] + "][" + e.Code + "]"}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	for _, f := range e.Fields {
+		parts = append(parts, f.Key+"="+f.Text())
+	}
+	return strings.Join(parts, " ")
+}
+
+func fieldText(f log.Field) string {
+	if f.Key == "" {
+		return ""
+	}
+	return f.Text()
+}
+
+// 捕获日志的Writer
+type Recorder struct {
+	mutex   sync.Mutex
+	entries []Entry
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) Init() error {
+	return nil
+}
+
+func (r *Recorder) Write(rec *log.Record) error {
+	e := Entry{
+		Level:   rec.Level(),
+		Time:    rec.Timestamp(),
+		Code:    rec.Code(),
+		Func:    rec.Func(),
+		Message: rec.Info(),
+	}
+	if fields := rec.Fields(); len(fields) > 0 {
+		e.Fields = make([]log.Field, len(fields))
+		copy(e.Fields, fields)
+	}
+	r.mutex.Lock()
+	r.entries = append(r.entries, e)
+	r.mutex.Unlock()
+	return nil
+}
+
+func (r *Recorder) Entries() []Entry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entries := make([]Entry, len(r.entries))
+	copy(entries, r.entries)
+	return entries
+}
+
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	r.entries = nil
+	r.mutex.Unlock()
+}
+
+// 满足全部条件的记录
+func (r *Recorder) Find(matchers ...Matcher) []Entry {
+	var found []Entry
+	for _, e := range r.Entries() {
+		if matchAll(e, matchers) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// 断言至少有一条满足条件的记录，返回第一条
+func (r *Recorder) Expect(t TestingT, matchers ...Matcher) Entry {
+	t.Helper()
+	found := r.Find(matchers...)
+	if len(found) == 0 {
+		t.Errorf("no log record matches %s\n%s", describe(matchers), r.dump())
+		return Entry{}
+	}
+	return found[0]
+}
+
+// 断言没有满足条件的记录
+func (r *Recorder) ExpectNone(t TestingT, matchers ...Matcher) {
+	t.Helper()
+	if found := r.Find(matchers...); len(found) > 0 {
+		t.Errorf("unexpected log record matches %s: %s", describe(matchers), found[0])
+	}
+}
+
+// 断言满足条件的记录条数
+func (r *Recorder) ExpectCount(t TestingT, n int, matchers ...Matcher) {
+	t.Helper()
+	if found := r.Find(matchers...); len(found) != n {
+		t.Errorf("expected %d log records match %s, got %d\n%s", n, describe(matchers), len(found), r.dump())
+	}
+}
+
+func (r *Recorder) dump() string {
+	entries := r.Entries()
+	if len(entries) == 0 {
+		return "captured: none"
+	}
+	lines := make([]string, 0, len(entries)+1)
+	lines = append(lines, "captured:")
+	for _, e := range entries {
+		lines = append(lines, "  "+e.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 同步写入Recorder的Logger，级别为TRACE
+func NewLogger() (*log.Logger, *Recorder) {
+	rec := NewRecorder()
+	l := log.NewSyncLogger()
+	l.SetLevel(log.TRACE)
+	l.Register(rec)
+	return l, rec
+}
+
+// 用同步Logger替换default Logger，log包级函数和lib.Log的日志都写入返回的Recorder
+// 返回的函数恢复原Logger，一般 defer 调用或传给 t.Cleanup
+func CaptureDefault() (*Recorder, func()) {
+	l, rec := NewLogger()
+	old := log.Set(log.DefaultLoggerName, l)
+	return rec, func() {
+		log.Set(log.DefaultLoggerName, old)
+		l.Close()
+	}
+}
+
+// 匹配条件
+type Matcher struct {
+	desc  string
+	match func(Entry) bool
+}
+
+func (m Matcher) String() string {
+	return m.desc
+}
+
+func matchAll(e Entry, matchers []Matcher) bool {
+	for _, m := range matchers {
+		if !m.match(e) {
+			return false
+		}
+	}
+	return true
+}
+
+func describe(matchers []Matcher) string {
+	if len(matchers) == 0 {
+		return "{}"
+	}
+	descs := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		descs = append(descs, m.desc)
+	}
+	return "{" + strings.Join(descs, ", ") + "}"
+}
+
+func Level(level int) Matcher {
+	return Matcher{"level=" + log.LEVEL_FLAGS[level], func(e Entry) bool { return e.Level == level }}
+}
+
+// 级别不低于level
+func MinLevel(level int) Matcher {
+	return Matcher{"level>=" + log.LEVEL_FLAGS[level], func(e Entry) bool { return e.Level >= level }}
+}
+
+func DLTag(tag string) Matcher {
+	return Matcher{"dltag=" + tag, func(e Entry) bool { return e.DLTag() == tag }}
+}
+
+func TraceId(id string) Matcher {
+	return Matcher{"traceid=" + id, func(e Entry) bool { return e.TraceId() == id }}
+}
+
+func Message(msg string) Matcher {
+	return Matcher{"message=" + msg, func(e Entry) bool { return e.Message == msg }}
+}
+
+func MessageContains(sub string) Matcher {
+	return Matcher{"message~" + sub, func(e Entry) bool { return strings.Contains(e.Message, sub) }}
+}
+
+// 字段存在且值相等，字符串按文本比较
+func Field(key string, value interface{}) Matcher {
+	return Matcher{fmt.Sprintf("%s=%v", key, value), func(e Entry) bool {
+		f, ok := e.Field(key)
+		if !ok {
+			return false
+		}
+		if s, ok := value.(string); ok {
+			return f.Text() == s
+		}
+		return reflect.DeepEqual(f.Value, value)
+	}}
+}
+
+func HasField(key string) Matcher {
+	return Matcher{"has " + key, func(e Entry) bool {
+		_, ok := e.Field(key)
+		return ok
+	}}
+}
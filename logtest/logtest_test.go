@@ -0,0 +1,129 @@
+package logtest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xiaka53/DeployAndLog/log"
+	"strings"
+	"testing"
+)
+
+// 记录断言失败信息，用于验证Expect系列方法
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorderCopiesRecord(t *testing.T) {
+	l, rec := NewLogger()
+	defer l.Close()
+
+	fields := []log.Field{log.String(log.FieldDLTag, "_com_a"), log.Int("n", 1)}
+	l.Log(log.INFO, "first", fields...)
+	fields[1] = log.Int("n", 2)
+	l.Log(log.WARNING, "second", log.String(log.FieldDLTag, "_com_b"))
+
+	entries := rec.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Message != "first" || e.Level != log.INFO || e.DLTag() != "_com_a" {
+		t.Fatalf("first entry changed after record reuse: %s", e)
+	}
+	if f, _ := e.Field("n"); f.Value != 1 {
+		t.Fatalf("entry shares fields with caller: n=%v", f.Value)
+	}
+	if !strings.HasPrefix(e.Code, "logtest_test.go:") {
+		t.Fatalf("code = %q, want caller position", e.Code)
+	}
+
+	entries[0].Message = "changed"
+	if rec.Entries()[0].Message != "first" {
+		t.Fatal("Entries returned the internal slice")
+	}
+	rec.Reset()
+	if len(rec.Entries()) != 0 {
+		t.Fatal("Reset kept entries")
+	}
+}
+
+func TestCaptureDefaultRestore(t *testing.T) {
+	old := log.Default()
+	rec, restore := CaptureDefault()
+	if log.Default() == old {
+		t.Fatal("default logger not replaced")
+	}
+	log.Log(log.ERROR, "captured", log.String(log.FieldDLTag, "_com_capture"))
+	restore()
+
+	if log.Default() != old {
+		t.Fatal("default logger not restored")
+	}
+	log.Log(log.ERROR, "after restore", log.String(log.FieldDLTag, "_com_capture"))
+
+	rec.ExpectCount(t, 1, DLTag("_com_capture"))
+	rec.Expect(t, Message("captured"), Level(log.ERROR))
+}
+
+func TestMatchers(t *testing.T) {
+	l, rec := NewLogger()
+	defer l.Close()
+	l.Log(log.DEBUG, "cache miss", log.String(log.FieldDLTag, "_com_redis_success"), log.String(log.FieldTraceId, "t1"))
+	l.Log(log.ERROR, "query failed", log.String(log.FieldDLTag, "_com_mysql_failure"), log.String(log.FieldTraceId, "t1"),
+		log.Int("rows", 3), log.Err("err", errors.New("timeout")))
+
+	cases := []struct {
+		matchers []Matcher
+		want     int
+	}{
+		{[]Matcher{Level(log.DEBUG)}, 1},
+		{[]Matcher{MinLevel(log.INFO)}, 1},
+		{[]Matcher{MinLevel(log.TRACE)}, 2},
+		{[]Matcher{DLTag("_com_mysql_failure")}, 1},
+		{[]Matcher{TraceId("t1")}, 2},
+		{[]Matcher{TraceId("t2")}, 0},
+		{[]Matcher{Message("cache miss")}, 1},
+		{[]Matcher{MessageContains("fail")}, 1},
+		{[]Matcher{Field("rows", 3)}, 1},
+		{[]Matcher{Field("rows", int64(3))}, 0},
+		{[]Matcher{Field("err", "timeout")}, 1},
+		{[]Matcher{HasField("rows")}, 1},
+		{[]Matcher{TraceId("t1"), Level(log.ERROR), HasField("err")}, 1},
+		{nil, 2},
+	}
+	for _, c := range cases {
+		if got := len(rec.Find(c.matchers...)); got != c.want {
+			t.Errorf("Find%s = %d, want %d", describe(c.matchers), got, c.want)
+		}
+	}
+}
+
+func TestExpectFailures(t *testing.T) {
+	l, rec := NewLogger()
+	defer l.Close()
+	l.Log(log.INFO, "hello", log.String(log.FieldDLTag, "_com_hello"))
+
+	ft := &fakeT{}
+	if e := rec.Expect(ft, DLTag("_com_hello")); e.Message != "hello" {
+		t.Fatalf("Expect returned %s", e)
+	}
+	if len(ft.errors) != 0 {
+		t.Fatalf("unexpected failures: %v", ft.errors)
+	}
+
+	rec.Expect(ft, DLTag("_com_missing"))
+	rec.ExpectNone(ft, MessageContains("hell"))
+	rec.ExpectCount(ft, 2, Level(log.INFO))
+	if len(ft.errors) != 3 {
+		t.Fatalf("got %d failures, want 3: %v", len(ft.errors), ft.errors)
+	}
+	if !strings.Contains(ft.errors[0], "dltag=_com_missing") || !strings.Contains(ft.errors[0], "_com_hello") {
+		t.Errorf("failure should describe matcher and captured records: %s", ft.errors[0])
+	}
+}